@@ -1,38 +1,94 @@
-//Package bits provides utils for manipulation bits of a single byte
+//Package bits provides utils for manipulation bits of bytes
 package bits
 
-const (
-	firstQuarter  = 192
-	secondQuarter = 48
-	thirdQuarter  = 12
-	fourthQuarter = 3
-)
-
 //QuartersOfByte returns a byte's four quarters of bits
+//
+//Deprecated: Use SplitBits with group size of 2 instead.
 func QuartersOfByte(b byte) [4]byte {
-	return [4]byte{b & firstQuarter >> 6, b & secondQuarter >> 4, b & thirdQuarter >> 2, b & fourthQuarter}
-}
-
-func clearLastTwoBits(b byte) byte {
-	return b & byte(252)
+	var quarters [4]byte
+	copy(quarters[:], SplitBits([]byte{b}, 2))
+	return quarters
 }
 
 //SetLastTwoBits modifies last two bits of given byte
+//
+//Deprecated: Use SetLastBits instead.
 func SetLastTwoBits(b byte, value byte) byte {
-	return clearLastTwoBits(b) | value
+	return SetLastBits(b, value, 2)
 }
 
 //GetLastTwoBits returns byte containing only last two bits of given byte
+//
+//Deprecated: Use GetLastBits instead.
 func GetLastTwoBits(b byte) byte {
-	return b & fourthQuarter
+	return GetLastBits(b, 2)
 }
 
 //ConstructByteOfQuarters constructs a byte of it's four quarters given
+//
+//Deprecated: Use JoinBits with group size of 2 instead.
 func ConstructByteOfQuarters(first, second, third, fourth byte) byte {
-	return (((first << 6) | (second << 4)) | third<<2) | fourth
+	return JoinBits([]byte{first, second, third, fourth}, 2)[0]
 }
 
 //ConstructByteOfQuartersAsSlice constructs a byte of it's four quarters given as byte slice
+//
+//Deprecated: Use JoinBits with group size of 2 instead.
 func ConstructByteOfQuartersAsSlice(b []byte) byte {
 	return ConstructByteOfQuarters(b[0], b[1], b[2], b[3])
 }
+
+func lastBitsMask(n uint) byte {
+	return byte(1)<<n - 1
+}
+
+//SetLastBits modifies last n bits of given byte
+func SetLastBits(b byte, value byte, n uint) byte {
+	return b&^lastBitsMask(n) | value&lastBitsMask(n)
+}
+
+//GetLastBits returns byte containing only last n bits of given byte
+func GetLastBits(b byte, n uint) byte {
+	return b & lastBitsMask(n)
+}
+
+//SplitBits splits given bytes in groups of n bits (1 <= n <= 8), starting from the most significant bits of the first byte.
+//Groups are allowed to span two bytes. If the number of bits is not aliquot of n, the last group is padded with zero bits.
+func SplitBits(bs []byte, n uint) []byte {
+	groups := make([]byte, 0, (len(bs)*8+int(n)-1)/int(n))
+
+	var acc uint16 // bits not yet grouped, aligned to the right
+	var accBits uint
+	for _, b := range bs {
+		acc = acc<<8 | uint16(b)
+		accBits += 8
+		for accBits >= n {
+			accBits -= n
+			groups = append(groups, byte(acc>>accBits)&lastBitsMask(n))
+		}
+	}
+	if accBits > 0 {
+		groups = append(groups, byte(acc<<(n-accBits))&lastBitsMask(n))
+	}
+
+	return groups
+}
+
+//JoinBits constructs bytes of given groups of n bits (1 <= n <= 8), as split by SplitBits.
+//Trailing bits not forming a whole byte are discarded.
+func JoinBits(groups []byte, n uint) []byte {
+	bs := make([]byte, 0, len(groups)*int(n)/8)
+
+	var acc uint16 // bits not yet joined, aligned to the right
+	var accBits uint
+	for _, group := range groups {
+		acc = acc<<n | uint16(group&lastBitsMask(n))
+		accBits += n
+		if accBits >= 8 {
+			accBits -= 8
+			bs = append(bs, byte(acc>>accBits))
+		}
+	}
+
+	return bs
+}
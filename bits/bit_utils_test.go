@@ -1,6 +1,7 @@
 package bits
 
 import (
+	"bytes"
 	"fmt"
 	"testing"
 )
@@ -133,3 +134,116 @@ func ExampleConstructByteOfQuartersAsSlice() {
 	//Output:
 	//11100111
 }
+
+func TestSetLastBits(t *testing.T) {
+	var tests = []struct {
+		b, v   byte
+		n      uint
+		result byte
+	}{
+		{byte(134), byte(1), 1, byte(135)},
+		{byte(134), byte(1), 2, byte(133)},
+		{byte(134), byte(5), 3, byte(133)},
+		{byte(134), byte(15), 4, byte(143)},
+		{byte(134), byte(255), 2, byte(135)},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("SetLastBits(%08b,%08b,%d)", test.b, test.v, test.n), func(t *testing.T) {
+			if actual := SetLastBits(test.b, test.v, test.n); actual != test.result {
+				t.Errorf("Expected %08b (%d) but got %08b (%d)", test.result, test.result, actual, actual)
+			}
+		})
+	}
+}
+
+func ExampleSetLastBits() {
+	fmt.Printf("%08b", SetLastBits(134, 5, 3)) // 134 is 10000110 and 5 is 00000101 in binary
+	//Output:
+	//10000101
+}
+
+func TestGetLastBits(t *testing.T) {
+	var tests = []struct {
+		b      byte
+		n      uint
+		result byte
+	}{
+		{byte(134), 1, byte(0)},
+		{byte(134), 2, byte(2)},
+		{byte(134), 3, byte(6)},
+		{byte(123), 4, byte(11)},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("GetLastBits(%08b,%d)", test.b, test.n), func(t *testing.T) {
+			if actual := GetLastBits(test.b, test.n); actual != test.result {
+				t.Errorf("Expected %08b (%d) but got %08b (%d)", test.result, test.result, actual, actual)
+			}
+		})
+	}
+}
+
+func ExampleGetLastBits() {
+	fmt.Printf("%08b", GetLastBits(134, 3)) // 134 is 10000110 in binary
+	//Output:
+	//00000110
+}
+
+func TestSplitBits(t *testing.T) {
+	var tests = []struct {
+		input  []byte
+		n      uint
+		result []byte
+	}{
+		{[]byte{231}, 1, []byte{1, 1, 1, 0, 0, 1, 1, 1}},
+		{[]byte{231}, 2, []byte{3, 2, 1, 3}},
+		{[]byte{231}, 3, []byte{7, 1, 6}},
+		{[]byte{231, 90, 239}, 3, []byte{7, 1, 6, 5, 5, 3, 5, 7}},
+		{[]byte{231, 90}, 4, []byte{14, 7, 5, 10}},
+		{[]byte{}, 2, []byte{}},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("SplitBits(%08b,%d)", test.input, test.n), func(t *testing.T) {
+			if actual := SplitBits(test.input, test.n); !bytes.Equal(actual, test.result) {
+				t.Errorf("Expected %08b (%d) but got %08b (%d)", test.result, test.result, actual, actual)
+			}
+		})
+	}
+}
+
+func ExampleSplitBits() {
+	fmt.Printf("%08b", SplitBits([]byte{231}, 3)) //231 is 11100111 in binary
+	//Output:
+	//[00000111 00000001 00000110]
+}
+
+func TestJoinBits(t *testing.T) {
+	var tests = []struct {
+		input  []byte
+		n      uint
+		result []byte
+	}{
+		{[]byte{1, 1, 1, 0, 0, 1, 1, 1}, 1, []byte{231}},
+		{[]byte{3, 2, 1, 3}, 2, []byte{231}},
+		{[]byte{7, 1, 6}, 3, []byte{231}},
+		{[]byte{7, 1, 6, 5, 5, 3, 5, 7}, 3, []byte{231, 90, 239}},
+		{[]byte{14, 7, 5, 10, 3}, 4, []byte{231, 90}},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("JoinBits(%08b,%d)", test.input, test.n), func(t *testing.T) {
+			if actual := JoinBits(test.input, test.n); !bytes.Equal(actual, test.result) {
+				t.Errorf("Expected %08b (%d) but got %08b (%d)", test.result, test.result, actual, actual)
+			}
+		})
+	}
+}
+
+func ExampleJoinBits() {
+	var groups = []byte{7, 1, 6} // 00000111 00000001 00000110 in binary
+	fmt.Printf("%08b", JoinBits(groups, 3))
+	//Output:
+	//[11100111]
+}
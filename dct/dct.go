@@ -0,0 +1,402 @@
+//Package dct reads and writes the quantized DCT coefficients of baseline JPEG images,
+//so they could be changed without decoding the pixels and encoding them again, which would lose the changes.
+package dct
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+//JPEG markers
+const (
+	markerSOF0 = 0xc0 // baseline DCT
+	markerSOF1 = 0xc1 // extended sequential DCT, Huffman coding
+	markerDHT  = 0xc4
+	markerRST0 = 0xd0
+	markerRST7 = 0xd7
+	markerSOI  = 0xd8
+	markerEOI  = 0xd9
+	markerSOS  = 0xda
+	markerDRI  = 0xdd
+)
+
+//UnsupportedError is returned by Decode when the image is a valid JPEG image that uses features which are not supported,
+//e.g. progressive images.
+type UnsupportedError string
+
+func (e UnsupportedError) Error() string {
+	return string(e)
+}
+
+//Block is a block of 8x8 quantized DCT coefficients in zig-zag order, the DC coefficient first.
+type Block [64]int16
+
+//Component is a color component of an Image.
+type Component struct {
+	ID         byte
+	H, V       int // horizontal and vertical sampling factors
+	QuantTable int // index of the quantization table of the component
+	BlocksX    int // number of blocks in a row, including the blocks padding the last MCU
+	BlocksY    int // number of rows of blocks, including the blocks padding the last MCU
+	Blocks     []Block
+
+	dcTable, acTable int // indices of the Huffman tables used in the scan
+}
+
+//Image is a baseline JPEG image decoded up to the quantized DCT coefficients of its components.
+//Everything else, including the quantization and Huffman tables and any metadata, is kept as it is,
+//so the image is encoded with the same tables and metadata.
+type Image struct {
+	Width, Height int
+	Components    []Component
+
+	header          []byte // the segments up to and including the header of the scan
+	trailer         []byte // the end of image marker and anything following it
+	huffman         [2][4]*huffmanTable
+	restartInterval int
+	mcusX, mcusY    int
+}
+
+//Decode reads a baseline JPEG image from r and decodes its quantized DCT coefficients.
+//Only sequential images with Huffman coding and a single scan of all components are supported.
+//The memory used is proportional to the size of the image, which is not limited, so it should be checked before if needed,
+//e.g. with image.DecodeConfig.
+func Decode(r io.Reader) (*Image, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 2 || data[0] != 0xff || data[1] != markerSOI {
+		return nil, fmt.Errorf("not a JPEG image")
+	}
+
+	img := &Image{}
+	frameFound := false
+	pos := 2
+	for {
+		marker, segment, next, err := readSegment(data, pos)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case marker == markerSOF0 || marker == markerSOF1:
+			if err := img.parseFrame(segment); err != nil {
+				return nil, err
+			}
+			frameFound = true
+		case marker >= 0xc2 && marker <= 0xcf && marker != markerDHT && marker != 0xc8 && marker != 0xcc:
+			return nil, UnsupportedError("unsupported JPEG image, only baseline images are supported")
+		case marker == markerDHT:
+			if err := img.parseHuffmanTables(segment); err != nil {
+				return nil, err
+			}
+		case marker == markerDRI:
+			if len(segment) != 2 {
+				return nil, fmt.Errorf("invalid JPEG restart interval")
+			}
+			img.restartInterval = int(binary.BigEndian.Uint16(segment))
+		case marker == markerEOI:
+			return nil, fmt.Errorf("JPEG image without scan")
+		case marker == markerSOS:
+			if !frameFound {
+				return nil, fmt.Errorf("JPEG scan before frame")
+			}
+			if err := img.parseScanHeader(segment); err != nil {
+				return nil, err
+			}
+			img.header = data[:next]
+			end, err := img.decodeScan(data[next:])
+			if err != nil {
+				return nil, err
+			}
+			img.trailer = data[next+end:]
+			if len(img.trailer) < 2 || img.trailer[0] != 0xff || img.trailer[1] != markerEOI {
+				return nil, UnsupportedError("unsupported JPEG image, only images with a single scan are supported")
+			}
+			return img, nil
+		}
+		pos = next
+	}
+}
+
+//readSegment reads the marker and the contents of the segment starting at pos and returns them along with the position of the next one.
+func readSegment(data []byte, pos int) (byte, []byte, int, error) {
+	for pos < len(data) && data[pos] == 0xff && pos+1 < len(data) && data[pos+1] == 0xff {
+		pos++ // fill bytes
+	}
+	if pos+2 > len(data) || data[pos] != 0xff {
+		return 0, nil, 0, fmt.Errorf("invalid JPEG marker")
+	}
+	marker := data[pos+1]
+	if marker == markerEOI || marker >= markerRST0 && marker <= markerRST7 || marker == 0x01 {
+		return marker, nil, pos + 2, nil // markers without contents
+	}
+	if pos+4 > len(data) {
+		return 0, nil, 0, fmt.Errorf("JPEG image truncated")
+	}
+	length := int(binary.BigEndian.Uint16(data[pos+2:]))
+	if length < 2 || pos+2+length > len(data) {
+		return 0, nil, 0, fmt.Errorf("JPEG image truncated")
+	}
+	return marker, data[pos+4 : pos+2+length], pos + 2 + length, nil
+}
+
+func (img *Image) parseFrame(segment []byte) error {
+	if len(img.Components) != 0 {
+		return fmt.Errorf("JPEG image with multiple frames")
+	}
+	if len(segment) < 6 || segment[0] != 8 {
+		return UnsupportedError("unsupported JPEG frame, only 8 bit precision is supported")
+	}
+	img.Height = int(binary.BigEndian.Uint16(segment[1:]))
+	img.Width = int(binary.BigEndian.Uint16(segment[3:]))
+	count := int(segment[5])
+	if img.Width == 0 || img.Height == 0 || count == 0 || len(segment) != 6+3*count {
+		return fmt.Errorf("invalid JPEG frame")
+	}
+
+	hMax, vMax := 1, 1
+	for i := 0; i < count; i++ {
+		c := Component{ID: segment[6+3*i], H: int(segment[7+3*i] >> 4), V: int(segment[7+3*i] & 0x0f), QuantTable: int(segment[8+3*i])}
+		if c.H < 1 || c.H > 4 || c.V < 1 || c.V > 4 || c.QuantTable > 3 {
+			return fmt.Errorf("invalid JPEG frame component")
+		}
+		if c.H > hMax {
+			hMax = c.H
+		}
+		if c.V > vMax {
+			vMax = c.V
+		}
+		img.Components = append(img.Components, c)
+	}
+
+	img.mcusX, img.mcusY = ceilDiv(img.Width, 8*hMax), ceilDiv(img.Height, 8*vMax)
+	for i := range img.Components {
+		c := &img.Components[i]
+		if count == 1 { // a single component is not interleaved, so there are no blocks padding the MCUs
+			c.BlocksX, c.BlocksY = ceilDiv(ceilDiv(img.Width*c.H, hMax), 8), ceilDiv(ceilDiv(img.Height*c.V, vMax), 8)
+		} else {
+			c.BlocksX, c.BlocksY = img.mcusX*c.H, img.mcusY*c.V
+		}
+		c.Blocks = make([]Block, c.BlocksX*c.BlocksY)
+	}
+	return nil
+}
+
+func (img *Image) parseScanHeader(segment []byte) error {
+	if len(segment) < 1 {
+		return fmt.Errorf("invalid JPEG scan")
+	}
+	count := int(segment[0])
+	if len(segment) != 4+2*count {
+		return fmt.Errorf("invalid JPEG scan")
+	}
+	if count != len(img.Components) {
+		return UnsupportedError("unsupported JPEG image, only images with a single scan are supported")
+	}
+	for i := 0; i < count; i++ {
+		c := &img.Components[i]
+		if segment[1+2*i] != c.ID {
+			return UnsupportedError("unsupported JPEG scan, its components should be in the order of the frame")
+		}
+		c.dcTable, c.acTable = int(segment[2+2*i]>>4), int(segment[2+2*i]&0x0f)
+		if c.dcTable > 3 || c.acTable > 3 || img.huffman[0][c.dcTable] == nil || img.huffman[1][c.acTable] == nil {
+			return fmt.Errorf("JPEG scan with missing Huffman table")
+		}
+	}
+	if segment[1+2*count] != 0 || segment[2+2*count] != 63 || segment[3+2*count] != 0 {
+		return UnsupportedError("unsupported JPEG image, only sequential images are supported")
+	}
+	return nil
+}
+
+//mcus calls f for the blocks of every MCU of the scan in order, with the index of their component.
+//The function restart is called between the MCUs at the restart intervals.
+func (img *Image) mcus(restart func() error, f func(component int, b *Block) error) error {
+	blocks := func(i int, x, y int) error {
+		c := &img.Components[i]
+		return f(i, &c.Blocks[y*c.BlocksX+x])
+	}
+	interleaved := len(img.Components) > 1
+	mcusX, mcusY := img.mcusX, img.mcusY
+	if !interleaved {
+		mcusX, mcusY = img.Components[0].BlocksX, img.Components[0].BlocksY
+	}
+
+	for my := 0; my < mcusY; my++ {
+		for mx := 0; mx < mcusX; mx++ {
+			if n := my*mcusX + mx; img.restartInterval > 0 && n > 0 && n%img.restartInterval == 0 {
+				if err := restart(); err != nil {
+					return err
+				}
+			}
+			if !interleaved {
+				if err := blocks(0, mx, my); err != nil {
+					return err
+				}
+				continue
+			}
+			for i := range img.Components {
+				c := &img.Components[i]
+				for v := 0; v < c.V; v++ {
+					for h := 0; h < c.H; h++ {
+						if err := blocks(i, mx*c.H+h, my*c.V+v); err != nil {
+							return err
+						}
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+//decodeScan decodes the coefficients of all blocks from the entropy coded data of the scan
+//and returns the position of the marker following the data.
+func (img *Image) decodeScan(data []byte) (int, error) {
+	r := &bitReader{data: data}
+	pred := make([]int, len(img.Components))
+	restarts := 0
+	restart := func() error {
+		if err := r.restart(byte(markerRST0 + restarts%8)); err != nil {
+			return err
+		}
+		restarts++
+		for i := range pred {
+			pred[i] = 0
+		}
+		return nil
+	}
+
+	err := img.mcus(restart, func(i int, b *Block) error {
+		c := &img.Components[i]
+		s, err := r.decodeHuffman(img.huffman[0][c.dcTable])
+		if err != nil {
+			return err
+		}
+		diff, err := r.receiveExtend(s)
+		if err != nil {
+			return err
+		}
+		pred[i] += diff
+		b[0] = int16(pred[i])
+
+		for k := 1; k < 64; k++ {
+			rs, err := r.decodeHuffman(img.huffman[1][c.acTable])
+			if err != nil {
+				return err
+			}
+			run, size := int(rs>>4), rs&0x0f
+			if size == 0 {
+				if run != 15 {
+					break // end of block
+				}
+				k += 15
+				continue
+			}
+			if k += run; k > 63 {
+				return fmt.Errorf("invalid JPEG scan data")
+			}
+			v, err := r.receiveExtend(size)
+			if err != nil {
+				return err
+			}
+			b[k] = int16(v)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for end := r.pos; end+1 < len(data); end++ { // skip any padding up to the next marker
+		if data[end] == 0xff && data[end+1] != 0 && (data[end+1] < markerRST0 || data[end+1] > markerRST7) {
+			return end, nil
+		}
+	}
+	return 0, fmt.Errorf("JPEG image truncated")
+}
+
+//Encode writes the image with the current coefficients as a baseline JPEG image to w,
+//using the same quantization and Huffman tables and keeping the metadata.
+//Every coefficient should be encodable with the Huffman tables of the image, which holds if it has the same magnitude category
+//as the decoded one and it is zero only if the decoded one is.
+func (img *Image) Encode(w io.Writer) error {
+	bw := &bitWriter{}
+	bw.buf = append(bw.buf, img.header...)
+
+	pred := make([]int, len(img.Components))
+	restarts := 0
+	restart := func() error {
+		bw.flush()
+		bw.buf = append(bw.buf, 0xff, byte(markerRST0+restarts%8))
+		restarts++
+		for i := range pred {
+			pred[i] = 0
+		}
+		return nil
+	}
+
+	err := img.mcus(restart, func(i int, b *Block) error {
+		c := &img.Components[i]
+		diff := int(b[0]) - pred[i]
+		pred[i] = int(b[0])
+		size := magnitudeCategory(diff)
+		if err := bw.encodeHuffman(img.huffman[0][c.dcTable], byte(size)); err != nil {
+			return err
+		}
+		bw.writeExtended(diff, size)
+
+		run := 0
+		for k := 1; k < 64; k++ {
+			v := int(b[k])
+			if v == 0 {
+				run++
+				continue
+			}
+			for ; run > 15; run -= 16 {
+				if err := bw.encodeHuffman(img.huffman[1][c.acTable], 0xf0); err != nil {
+					return err
+				}
+			}
+			size := magnitudeCategory(v)
+			if err := bw.encodeHuffman(img.huffman[1][c.acTable], byte(run<<4|size)); err != nil {
+				return err
+			}
+			bw.writeExtended(v, size)
+			run = 0
+		}
+		if run > 0 {
+			return bw.encodeHuffman(img.huffman[1][c.acTable], 0x00) // end of block
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	bw.flush()
+
+	if _, err := w.Write(bw.buf); err != nil {
+		return err
+	}
+	_, err = w.Write(img.trailer)
+	return err
+}
+
+//magnitudeCategory returns the number of bits of the magnitude of v.
+func magnitudeCategory(v int) int {
+	if v < 0 {
+		v = -v
+	}
+	size := 0
+	for ; v != 0; v >>= 1 {
+		size++
+	}
+	return size
+}
+
+func ceilDiv(a, b int) int {
+	return (a + b - 1) / b
+}
@@ -0,0 +1,160 @@
+package dct
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"io/ioutil"
+	"testing"
+)
+
+func TestEncodeShouldPreserveImage(t *testing.T) {
+	for _, name := range []string{"../examples/street.jpeg", "../examples/lake.jpeg"} {
+		t.Run(name, func(t *testing.T) {
+			original, err := ioutil.ReadFile(name)
+			if err != nil {
+				t.Fatalf("Error reading image: %v", err)
+			}
+			img, err := Decode(bytes.NewReader(original))
+			if err != nil {
+				t.Fatalf("Error decoding coefficients: %v", err)
+			}
+
+			var encoded bytes.Buffer
+			if err := img.Encode(&encoded); err != nil {
+				t.Fatalf("Error encoding coefficients: %v", err)
+			}
+			assertSamePixels(t, original, encoded.Bytes())
+		})
+	}
+}
+
+func TestEncodeWithRestartInterval(t *testing.T) {
+	original, err := ioutil.ReadFile("../examples/street.jpeg")
+	if err != nil {
+		t.Fatalf("Error reading image: %v", err)
+	}
+	img, err := Decode(bytes.NewReader(original))
+	if err != nil {
+		t.Fatalf("Error decoding coefficients: %v", err)
+	}
+	img.restartInterval = 7
+	img.header = append([]byte{0xff, markerSOI, 0xff, markerDRI, 0, 4, 0, 7}, img.header[2:]...)
+
+	var encoded bytes.Buffer
+	if err := img.Encode(&encoded); err != nil {
+		t.Fatalf("Error encoding coefficients: %v", err)
+	}
+	if !bytes.Contains(encoded.Bytes(), []byte{0xff, markerRST7}) {
+		t.Fatalf("Expected restart markers in the encoded image")
+	}
+	assertSamePixels(t, original, encoded.Bytes())
+
+	decoded, err := Decode(bytes.NewReader(encoded.Bytes()))
+	if err != nil {
+		t.Fatalf("Error decoding coefficients with restart interval: %v", err)
+	}
+	for i, c := range decoded.Components {
+		for j, b := range c.Blocks {
+			if b != img.Components[i].Blocks[j] {
+				t.Fatalf("Block %d of component %d does not match the encoded one", j, i)
+			}
+		}
+	}
+}
+
+func TestEncodeShouldKeepChangedCoefficients(t *testing.T) {
+	original, err := ioutil.ReadFile("../examples/lake.jpeg")
+	if err != nil {
+		t.Fatalf("Error reading image: %v", err)
+	}
+	img, err := Decode(bytes.NewReader(original))
+	if err != nil {
+		t.Fatalf("Error decoding coefficients: %v", err)
+	}
+	changed := 0
+	for _, c := range img.Components {
+		for i := range c.Blocks {
+			for k := 1; k < 64; k++ {
+				switch v := c.Blocks[i][k]; {
+				case v >= 2: // flipping the least significant bit of the magnitude keeps its category
+					c.Blocks[i][k] = v ^ 1
+					changed++
+				case v <= -2:
+					c.Blocks[i][k] = -(-v ^ 1)
+					changed++
+				}
+			}
+		}
+	}
+	if changed == 0 {
+		t.Fatalf("Expected some coefficients to change")
+	}
+
+	var encoded bytes.Buffer
+	if err := img.Encode(&encoded); err != nil {
+		t.Fatalf("Error encoding coefficients: %v", err)
+	}
+	decoded, err := Decode(bytes.NewReader(encoded.Bytes()))
+	if err != nil {
+		t.Fatalf("Error decoding coefficients: %v", err)
+	}
+	for i, c := range decoded.Components {
+		for j, b := range c.Blocks {
+			if b != img.Components[i].Blocks[j] {
+				t.Fatalf("Block %d of component %d does not match the encoded one", j, i)
+			}
+		}
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(encoded.Bytes())); err != nil {
+		t.Errorf("Error decoding encoded image: %v", err)
+	}
+}
+
+func TestDecodeShouldReturnErrorWhenImageIsUnsupported(t *testing.T) {
+	original, err := ioutil.ReadFile("../examples/street.jpeg")
+	if err != nil {
+		t.Fatalf("Error reading image: %v", err)
+	}
+	progressive := append([]byte{}, original...)
+	progressive[bytes.Index(progressive, []byte{0xff, markerSOF0})+1] = 0xc2
+
+	var tests = []struct {
+		name string
+		data []byte
+	}{
+		{"Not a JPEG image", []byte("GIF89a")},
+		{"Truncated image", original[:len(original)/2]},
+		{"Progressive image", progressive},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Decode(bytes.NewReader(test.data))
+			if err == nil {
+				t.Fatal("Expected error")
+			}
+			t.Log(err)
+		})
+	}
+}
+
+//assertSamePixels checks that the JPEG images decode to the same pixels.
+func assertSamePixels(t *testing.T, expected, actual []byte) {
+	expectedImg, err := jpeg.Decode(bytes.NewReader(expected))
+	if err != nil {
+		t.Fatalf("Error decoding image: %v", err)
+	}
+	actualImg, err := jpeg.Decode(bytes.NewReader(actual))
+	if err != nil {
+		t.Fatalf("Error decoding encoded image: %v", err)
+	}
+	e, ok1 := expectedImg.(*image.YCbCr)
+	a, ok2 := actualImg.(*image.YCbCr)
+	if !ok1 || !ok2 {
+		t.Fatalf("Expected YCbCr images but got %T and %T", expectedImg, actualImg)
+	}
+	if !bytes.Equal(e.Y, a.Y) || !bytes.Equal(e.Cb, a.Cb) || !bytes.Equal(e.Cr, a.Cr) {
+		t.Errorf("Encoded image does not match the original")
+	}
+}
@@ -0,0 +1,195 @@
+package dct
+
+import (
+	"fmt"
+)
+
+//huffmanTable is a canonical Huffman table of JPEG symbols, used both for decoding and encoding them.
+type huffmanTable struct {
+	maxCode [17]int32 // largest code of given length, -1 if there are none
+	valPtr  [17]int32 // index in values of the first symbol of given code length, less its code
+	values  []byte
+
+	codes [256]uint16 // code of every symbol
+	sizes [256]uint8  // length of the code of every symbol, zero for the symbols not in the table
+}
+
+//parseHuffmanTables parses the tables defined in a DHT segment.
+func (img *Image) parseHuffmanTables(segment []byte) error {
+	for len(segment) > 0 {
+		if len(segment) < 17 {
+			return fmt.Errorf("invalid JPEG Huffman table")
+		}
+		class, id := int(segment[0]>>4), int(segment[0]&0x0f)
+		if class > 1 || id > 3 {
+			return fmt.Errorf("invalid JPEG Huffman table")
+		}
+		counts := segment[1:17]
+		total := 0
+		for _, c := range counts {
+			total += int(c)
+		}
+		if total > 256 || len(segment) < 17+total {
+			return fmt.Errorf("invalid JPEG Huffman table")
+		}
+		t, err := newHuffmanTable(counts, segment[17:17+total])
+		if err != nil {
+			return err
+		}
+		img.huffman[class][id] = t
+		segment = segment[17+total:]
+	}
+	return nil
+}
+
+//newHuffmanTable builds the canonical Huffman table with given number of codes of every length from 1 to 16 and their symbols.
+func newHuffmanTable(counts []byte, values []byte) (*huffmanTable, error) {
+	t := &huffmanTable{values: values}
+	code, k := int32(0), 0
+	for length := 1; length <= 16; length++ {
+		count := int(counts[length-1])
+		t.maxCode[length] = -1
+		if count != 0 {
+			t.valPtr[length] = int32(k) - code
+			for i := 0; i < count; i++ {
+				symbol := values[k]
+				if t.sizes[symbol] == 0 { // the first code of a symbol listed more than once is used for encoding
+					t.codes[symbol], t.sizes[symbol] = uint16(code), uint8(length)
+				}
+				code++
+				k++
+			}
+			t.maxCode[length] = code - 1
+		}
+		if code > 1<<uint(length) {
+			return nil, fmt.Errorf("invalid JPEG Huffman table")
+		}
+		code <<= 1
+	}
+	return t, nil
+}
+
+//bitReader reads bits of the entropy coded data of a scan, skipping the bytes stuffed after 0xff.
+type bitReader struct {
+	data []byte
+	pos  int
+	bits uint32 // bits read but not consumed yet, in the lowest n bits
+	n    uint
+}
+
+func (r *bitReader) bit() (int, error) {
+	if r.n == 0 {
+		if r.pos >= len(r.data) {
+			return 0, fmt.Errorf("JPEG scan data truncated")
+		}
+		b := r.data[r.pos]
+		if b == 0xff {
+			if r.pos+1 >= len(r.data) || r.data[r.pos+1] != 0 {
+				return 0, fmt.Errorf("JPEG scan data truncated")
+			}
+			r.pos++ // stuffed zero byte
+		}
+		r.pos++
+		r.bits, r.n = uint32(b), 8
+	}
+	r.n--
+	return int(r.bits>>r.n) & 1, nil
+}
+
+func (r *bitReader) receive(size int) (int, error) {
+	v := 0
+	for i := 0; i < size; i++ {
+		b, err := r.bit()
+		if err != nil {
+			return 0, err
+		}
+		v = v<<1 | b
+	}
+	return v, nil
+}
+
+//receiveExtend reads a value of given magnitude category.
+func (r *bitReader) receiveExtend(size byte) (int, error) {
+	if size == 0 {
+		return 0, nil
+	}
+	if size > 15 {
+		return 0, fmt.Errorf("invalid JPEG scan data")
+	}
+	v, err := r.receive(int(size))
+	if err != nil {
+		return 0, err
+	}
+	if v < 1<<(size-1) { // negative values are stored as their one's complement
+		v -= 1<<size - 1
+	}
+	return v, nil
+}
+
+func (r *bitReader) decodeHuffman(t *huffmanTable) (byte, error) {
+	code := int32(0)
+	for length := 1; length <= 16; length++ {
+		b, err := r.bit()
+		if err != nil {
+			return 0, err
+		}
+		code = code<<1 | int32(b)
+		if code <= t.maxCode[length] {
+			return t.values[t.valPtr[length]+code], nil
+		}
+	}
+	return 0, fmt.Errorf("invalid JPEG Huffman code")
+}
+
+//restart skips the rest of the current byte and the restart marker, which should be the given one.
+func (r *bitReader) restart(marker byte) error {
+	r.n = 0
+	if r.pos+1 >= len(r.data) || r.data[r.pos] != 0xff || r.data[r.pos+1] != marker {
+		return fmt.Errorf("JPEG restart marker missing")
+	}
+	r.pos += 2
+	return nil
+}
+
+//bitWriter writes bits of the entropy coded data of a scan, stuffing a zero byte after every 0xff.
+type bitWriter struct {
+	buf  []byte
+	bits uint32 // bits not written yet, in the lowest n bits
+	n    uint
+}
+
+func (w *bitWriter) write(v uint32, size uint) {
+	w.bits = w.bits<<size | v&(1<<size-1)
+	w.n += size
+	for w.n >= 8 {
+		w.n -= 8
+		b := byte(w.bits >> w.n)
+		w.buf = append(w.buf, b)
+		if b == 0xff {
+			w.buf = append(w.buf, 0)
+		}
+	}
+}
+
+//writeExtended writes value v of given magnitude category.
+func (w *bitWriter) writeExtended(v, size int) {
+	if v < 0 {
+		v += 1<<uint(size) - 1
+	}
+	w.write(uint32(v), uint(size))
+}
+
+func (w *bitWriter) encodeHuffman(t *huffmanTable, symbol byte) error {
+	if t.sizes[symbol] == 0 {
+		return fmt.Errorf("symbol %#x missing in JPEG Huffman table", symbol)
+	}
+	w.write(uint32(t.codes[symbol]), uint(t.sizes[symbol]))
+	return nil
+}
+
+//flush pads the last byte with one bits.
+func (w *bitWriter) flush() {
+	if w.n > 0 {
+		w.write(1<<(8-w.n)-1, 8-w.n)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"github.com/DimitarPetrov/stegify/steg"
+	"io"
+	"os"
+	"strings"
+)
+
+const progressBarWidth = 40
+
+//progressBar renders the progress of encoding or decoding on a terminal.
+type progressBar struct {
+	w       io.Writer
+	percent int // last rendered percent, -1 if nothing is rendered yet
+}
+
+func newProgressBar(w io.Writer) *progressBar {
+	return &progressBar{w: w, percent: -1}
+}
+
+//isTerminal tells if f is attached to a terminal.
+func isTerminal(f *os.File) bool {
+	stat, err := f.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+//update renders p, unless the percent did not grow since the last time.
+//The percent is of the bytes of data when their total is known and of the pixels of the carriers otherwise.
+func (b *progressBar) update(p steg.Progress) {
+	percent := 0
+	switch {
+	case p.TotalBytes > 0:
+		percent = int(p.Bytes * 100 / p.TotalBytes)
+	case p.TotalPixels > 0:
+		percent = p.Pixels * 100 / p.TotalPixels
+	}
+	if percent > 100 {
+		percent = 100
+	}
+	if percent <= b.percent { // the totals grow as the carriers are read, so the percent could drop for a while
+		return
+	}
+	b.percent = percent
+
+	filled := percent * progressBarWidth / 100
+	fmt.Fprintf(b.w, "\r[%s%s] %3d%%", strings.Repeat("#", filled), strings.Repeat(" ", progressBarWidth-filled), percent)
+}
+
+//finish ends the line of the progress bar, if it is rendered.
+func (b *progressBar) finish() {
+	if b.percent >= 0 {
+		fmt.Fprintln(b.w)
+	}
+}
@@ -0,0 +1,244 @@
+package steg
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const archiveContentType = "application/x-tar"
+
+//packArchive packs the files and directories with given names in a tar archive. Directories are packed recursively,
+//with the paths of their entries relative to the parent of the directory. Only regular files and directories are supported.
+func packArchive(fileNames []string) ([]byte, error) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	packed := make(map[string]bool)
+
+	for _, fileName := range fileNames {
+		absName, err := filepath.Abs(fileName) // names like . or .. have no parent to be relative to otherwise
+		if err != nil {
+			return nil, fmt.Errorf("error archiving data file %s: %v", fileName, err)
+		}
+		parent := filepath.Dir(absName)
+		if parent == absName {
+			return nil, fmt.Errorf("error archiving data file %s: the root directory could not be archived", fileName)
+		}
+		err = filepath.Walk(absName, func(name string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(parent, name)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			if packed[rel] {
+				return fmt.Errorf("%s given more than once", rel)
+			}
+			packed[rel] = true
+			return packArchiveEntry(tw, name, rel, info)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error archiving data file %s: %v", fileName, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("error archiving data files: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func packArchiveEntry(tw *tar.Writer, name, rel string, info os.FileInfo) error {
+	if !info.Mode().IsRegular() && !info.IsDir() {
+		return fmt.Errorf("%s is neither a regular file nor a directory", name)
+	}
+
+	hdr := &tar.Header{
+		Name:    rel,
+		Mode:    int64(info.Mode().Perm()),
+		ModTime: info.ModTime(),
+	}
+	if info.IsDir() {
+		hdr.Typeflag = tar.TypeDir
+		hdr.Name += "/"
+	} else {
+		hdr.Typeflag = tar.TypeReg
+		hdr.Size = info.Size()
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return nil
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(tw, file)
+	return err
+}
+
+//extractArchive extracts the tar archive packed by packArchive in the directory with given name, which is created if needed.
+//Entries with absolute paths or paths pointing outside of the directory are rejected. Existing files are never overwritten
+//and no entry is written through an existing symbolic link, so an archive could not change files it did not create.
+//Once the archive is read, verify is called with the error of extracting it, if any. If it returns an error,
+//the files and directories created by the extraction are removed.
+func extractArchive(archive io.Reader, dir string, verify func(err error) error) error {
+	e := &archiveExtractor{}
+	err := e.extract(archive, dir)
+	if err = verify(err); err != nil {
+		e.removeCreated()
+		return err
+	}
+	return nil
+}
+
+//archiveExtractor extracts an archive and keeps track of the files and directories it creates.
+type archiveExtractor struct {
+	created  []string
+	dirTimes []dirTime // restored last, as extracting the entries of a directory changes its modification time
+}
+
+type dirTime struct {
+	name    string
+	modTime time.Time
+}
+
+func (e *archiveExtractor) extract(archive io.Reader, dir string) error {
+	if err := e.mkdirAll(dir); err != nil {
+		return fmt.Errorf("error creating output directory: %v", err)
+	}
+
+	tr := tar.NewReader(archive)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error reading archive: %v", err)
+		}
+
+		target, err := archiveEntryPath(dir, hdr.Name)
+		if err != nil {
+			return err
+		}
+		mode := os.FileMode(hdr.Mode).Perm()
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if _, err := os.Lstat(target); err == nil {
+				continue // the permissions and the modification time of existing directories are kept
+			}
+			if err := e.mkdirAll(target); err != nil {
+				return fmt.Errorf("error creating directory %s: %v", target, err)
+			}
+			if err := os.Chmod(target, mode|0700); err != nil { // the owner should still be able to extract the entries
+				return fmt.Errorf("error restoring permissions of directory %s: %v", target, err)
+			}
+			e.dirTimes = append(e.dirTimes, dirTime{name: target, modTime: hdr.ModTime})
+		case tar.TypeReg:
+			if err := e.extractFile(tr, target, mode, hdr.ModTime); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported archive entry %s", hdr.Name)
+		}
+	}
+
+	for i := len(e.dirTimes) - 1; i >= 0; i-- {
+		if err := os.Chtimes(e.dirTimes[i].name, e.dirTimes[i].modTime, e.dirTimes[i].modTime); err != nil {
+			return fmt.Errorf("error restoring modification time of directory %s: %v", e.dirTimes[i].name, err)
+		}
+	}
+	return nil
+}
+
+//mkdirAll creates the directory with given name along with any missing parents.
+func (e *archiveExtractor) mkdirAll(name string) error {
+	var missing []string
+	for dir := name; dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		if _, err := os.Lstat(dir); !os.IsNotExist(err) {
+			break
+		}
+		missing = append(missing, dir)
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		if err := os.Mkdir(missing[i], 0755); err != nil {
+			return err
+		}
+		e.created = append(e.created, missing[i])
+	}
+	return nil
+}
+
+//removeCreated removes the files and directories created by the extraction, in reverse order.
+func (e *archiveExtractor) removeCreated() {
+	for i := len(e.created) - 1; i >= 0; i-- {
+		_ = os.Remove(e.created[i])
+	}
+}
+
+//archiveEntryPath returns the path in dir at which the archive entry with given name should be extracted.
+//Entries pointing outside of dir or through an existing symbolic link in it are rejected.
+func archiveEntryPath(dir, name string) (string, error) {
+	cleaned := path.Clean(strings.Replace(name, "\\", "/", -1))
+	if path.IsAbs(cleaned) || cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") || filepath.VolumeName(cleaned) != "" {
+		return "", fmt.Errorf("archive entry %s points outside of the output directory", name)
+	}
+
+	target := dir
+	for _, element := range strings.Split(cleaned, "/") {
+		target = filepath.Join(target, element)
+		stat, err := os.Lstat(target)
+		if os.IsNotExist(err) {
+			break // nothing below it exists either
+		}
+		if err != nil {
+			return "", fmt.Errorf("error checking archive entry %s: %v", name, err)
+		}
+		if stat.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("archive entry %s points through symbolic link %s", name, target)
+		}
+	}
+	return filepath.Join(dir, filepath.FromSlash(cleaned)), nil
+}
+
+func (e *archiveExtractor) extractFile(r io.Reader, name string, mode os.FileMode, modTime time.Time) (err error) {
+	if err := e.mkdirAll(filepath.Dir(name)); err != nil {
+		return fmt.Errorf("error creating directory %s: %v", filepath.Dir(name), err)
+	}
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return fmt.Errorf("error creating file %s: %v", name, err)
+	}
+	e.created = append(e.created, name)
+	defer func() {
+		closeErr := file.Close()
+		if err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Chmod(name, mode) // the permissions the file is created with are limited by the umask
+		}
+		if err == nil {
+			err = os.Chtimes(name, modTime, modTime)
+		}
+	}()
+
+	if _, err := io.Copy(file, r); err != nil {
+		return fmt.Errorf("error extracting file %s: %v", name, err)
+	}
+	return nil
+}
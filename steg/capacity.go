@@ -0,0 +1,172 @@
+package steg
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	mathbits "math/bits"
+	"os"
+)
+
+//Capacity returns the maximum number of bytes of data which could be encoded in carrier using the given options.
+//Only the configuration of the carrier, like the size of an image, is read where possible, so it is much cheaper than attempting to encode the data.
+func Capacity(carrier io.Reader, opts *Options) (int, error) {
+	return capacity(carrier, opts.orDefault(), nil)
+}
+
+//capacity returns the maximum number of bytes of data which could be encoded in carrier,
+//optionally as a chunk of data split in multiple carriers.
+func capacity(carrier io.Reader, opts *Options, chunk *chunkInfo) (int, error) {
+	samples, err := carrierSamples(carrier, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	h, err := newHeader(opts, chunk)
+	if err != nil {
+		return 0, err
+	}
+
+	return capacityOf(samples, h), nil
+}
+
+//MultiCarrierCapacityByFileNames returns the maximum number of bytes of data which could be encoded in each of the carrier files
+//by the MultiCarrierEncode function using the given options. The total capacity of the carriers is the sum of the results.
+//With parity every data carrier holds as much data as the smallest carrier could, while the parity carriers hold none.
+//With threshold every carrier holds a share of the whole data, so the capacity of the smallest carrier is reported for the first one.
+func MultiCarrierCapacityByFileNames(carrierFileNames []string, opts *Options) ([]int, error) {
+	opts = opts.orDefault()
+	if len(carrierFileNames) == 0 {
+		return nil, fmt.Errorf("missing carriers names")
+	}
+	if err := validateRedundancy(len(carrierFileNames), opts); err != nil {
+		return nil, err
+	}
+
+	capacities := make([]int, 0, len(carrierFileNames))
+	for _, name := range carrierFileNames {
+		capacity, err := capacityByFileName(name, opts, chunkTemplate(len(carrierFileNames), opts))
+		if err != nil {
+			return nil, err
+		}
+		capacities = append(capacities, capacity)
+	}
+
+	if opts.Parity != 0 || opts.Threshold != 0 {
+		dataCarriers := len(capacities) - opts.Parity
+		if opts.Threshold != 0 {
+			dataCarriers = 1
+		}
+		shardCapacity := redundantCapacity(capacities, opts) / dataCarriers
+		for i := range capacities {
+			capacities[i] = 0
+			if i < dataCarriers {
+				capacities[i] = shardCapacity
+			}
+		}
+	}
+	return capacities, nil
+}
+
+func capacityByFileName(carrierFileName string, opts *Options, chunk *chunkInfo) (int, error) {
+	carrier, err := os.Open(carrierFileName)
+	if err != nil {
+		return 0, fmt.Errorf("error opening carrier file %s: %v", carrierFileName, err)
+	}
+	defer carrier.Close()
+
+	c, err := capacity(carrier, opts, chunk)
+	if err != nil {
+		return 0, fmt.Errorf("error calculating capacity of carrier file %s: %v", carrierFileName, err)
+	}
+	return c, nil
+}
+
+//PayloadSize returns the number of bytes of capacity, which data would take when encoded using the given options.
+//It accounts for the compression and the recorded file info, so it could be compared with the capacity of the carriers before encoding.
+func PayloadSize(data io.Reader, opts *Options) (int, error) {
+	p, err := payload(data, opts.orDefault())
+	if err != nil {
+		return 0, err
+	}
+	defer p.Close()
+
+	n, err := io.Copy(ioutil.Discard, p)
+	if err != nil {
+		return 0, fmt.Errorf("error reading data %v", err)
+	}
+	return int(n), nil
+}
+
+//PayloadSizeByFileNames returns the number of bytes of capacity, which the data files and directories would take
+//when encoded by the MultiCarrierEncodeFilesByFileNamesWithOptions function using the given options.
+func PayloadSizeByFileNames(dataFileNames []string, opts *Options) (int, error) {
+	opts = opts.orDefault()
+	if len(dataFileNames) == 0 {
+		return 0, fmt.Errorf("missing data files names")
+	}
+
+	data, info, err := openDataFiles(dataFileNames)
+	if err != nil {
+		return 0, err
+	}
+	defer data.Close()
+
+	if opts.FileInfo == nil {
+		withInfo := *opts
+		withInfo.FileInfo = info
+		opts = &withInfo
+	}
+	return PayloadSize(data, opts)
+}
+
+//capacityOf returns the maximum number of bytes of data, which could be encoded in given number of slots
+//after a header of the given kind.
+func capacityOf(slotsCount int, h header) int {
+	dataSlots := slotsCount - dataOffset(h.size())
+	if dataSlots <= 0 {
+		return 0
+	}
+
+	capacity := dataSlots * int(h.depth) / 8
+	if h.flags&flagEncrypted != 0 {
+		capacity -= sealOverhead
+	}
+	if capacity < 0 {
+		return 0
+	}
+	return capacity
+}
+
+//splitByCapacity returns the sizes of the chunks in which data of given length should be split,
+//so that every chunk is proportional to the capacity of the respective carrier.
+func splitByCapacity(length int, capacities []int) ([]int, error) {
+	var total uint64
+	for _, capacity := range capacities {
+		total += uint64(capacity)
+	}
+	if uint64(length) > total {
+		return nil, fmt.Errorf("data file too large for these carriers, total capacity is %d bytes", total)
+	}
+
+	sizes := make([]int, len(capacities))
+	if length == 0 {
+		return sizes, nil
+	}
+
+	remaining := length
+	for i, capacity := range capacities {
+		hi, lo := mathbits.Mul64(uint64(length), uint64(capacity))
+		quo, _ := mathbits.Div64(hi, lo, total) // cannot overflow as length <= total
+		sizes[i] = int(quo)
+		remaining -= sizes[i]
+	}
+
+	for i := 0; remaining > 0; i++ { // rounding leaves less than one byte per carrier
+		if sizes[i] < capacities[i] {
+			sizes[i]++
+			remaining--
+		}
+	}
+	return sizes, nil
+}
@@ -0,0 +1,134 @@
+package steg_test
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/DimitarPetrov/stegify/steg"
+	"image"
+	"image/png"
+	"os"
+	"testing"
+)
+
+func TestCapacity(t *testing.T) {
+	tests := []struct {
+		name string
+		opts *steg.Options
+	}{
+		{name: "Default options", opts: nil},
+		{name: "Depth 1", opts: &steg.Options{Depth: 1}},
+		{name: "Depth 3", opts: &steg.Options{Depth: 3}},
+		{name: "Depth 4", opts: &steg.Options{Depth: 4}},
+		{name: "With password", opts: &steg.Options{Password: []byte("secret")}},
+		{name: "With key", opts: &steg.Options{Key: []byte("key")}},
+		{name: "With channels", opts: &steg.Options{Channels: steg.Red | steg.Blue}},
+		{name: "With single channel and key", opts: &steg.Options{Channels: steg.Green, Key: []byte("key")}},
+	}
+
+	carrier := newCarrier(t, 37, 23)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			capacity, err := steg.Capacity(bytes.NewReader(carrier), test.opts)
+			if err != nil {
+				t.Fatalf("Error calculating capacity: %v", err)
+			}
+
+			var result bytes.Buffer
+			err = steg.EncodeWithOptions(bytes.NewReader(carrier), bytes.NewReader(make([]byte, capacity)), &result, test.opts)
+			if err != nil {
+				t.Fatalf("Expected data of %d bytes to fit in the carrier: %v", capacity, err)
+			}
+
+			err = steg.EncodeWithOptions(bytes.NewReader(carrier), bytes.NewReader(make([]byte, capacity+1)), &result, test.opts)
+			if err == nil {
+				t.Fatalf("Expected data of %d bytes not to fit in the carrier", capacity+1)
+			}
+		})
+	}
+}
+
+func ExampleCapacity() {
+	carrier, err := os.Open("../examples/street.jpeg")
+	if err != nil {
+		panic(err)
+	}
+	defer carrier.Close()
+
+	capacity, err := steg.Capacity(carrier, nil)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(capacity)
+	//Output:
+	//1843182
+}
+
+func TestCapacityShouldReturnErrorWhenCarrierFileIsNotImage(t *testing.T) {
+	carrier, err := os.Open("../README.md")
+	if err != nil {
+		t.Fatalf("Error opening carrier file: %v", err)
+	}
+	defer carrier.Close()
+
+	_, err = steg.Capacity(carrier, nil)
+	if err == nil {
+		t.FailNow()
+	}
+	t.Log(err)
+}
+
+func TestMultiCarrierCapacityByFileNames(t *testing.T) {
+	tests := []struct {
+		name       string
+		carriers   []string
+		capacities []int
+	}{
+		{
+			name:       "Single carrier",
+			carriers:   []string{"../examples/street.jpeg"},
+			capacities: []int{1843182}, // same as Capacity
+		},
+		{
+			name:       "Multiple carriers",
+			carriers:   []string{"../examples/street.jpeg", "../examples/lake.jpeg"},
+			capacities: []int{1843170, 2359266}, // every carrier holds information about its chunk as well
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			capacities, err := steg.MultiCarrierCapacityByFileNames(test.carriers, nil)
+			if err != nil {
+				t.Fatalf("Error calculating capacity: %v", err)
+			}
+			if fmt.Sprint(capacities) != fmt.Sprint(test.capacities) {
+				t.Errorf("Expected capacities %v but got %v", test.capacities, capacities)
+			}
+		})
+	}
+}
+
+func TestMultiCarrierCapacityByFileNamesShouldReturnErrorWhenCarrierFileMissing(t *testing.T) {
+	_, err := steg.MultiCarrierCapacityByFileNames([]string{"../examples/street.jpeg", "not_existing_file"}, nil)
+	if err == nil {
+		t.FailNow()
+	}
+	t.Log(err)
+}
+
+func newCarrier(t *testing.T, width, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = byte(i * 7)
+		if i%4 == 3 {
+			img.Pix[i] = 255 // opaque
+		}
+	}
+
+	var carrier bytes.Buffer
+	if err := png.Encode(&carrier, img); err != nil {
+		t.Fatalf("Error encoding carrier image: %v", err)
+	}
+	return carrier.Bytes()
+}
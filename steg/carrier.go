@@ -0,0 +1,115 @@
+package steg
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/DimitarPetrov/stegify/dct"
+	"io"
+	"sync"
+)
+
+//Carrier is a decoded carrier in which the data is encoded in the least significant bits of its samples,
+//e.g. the color channels of the pixels of an image. The samples are bytes of a buffer owned by the carrier.
+//Carriers of new kinds could be supported by registering their format with RegisterCarrierFormat.
+type Carrier interface {
+	//Buffer returns the buffer holding the samples. The changes to it are reflected in the carrier when it is encoded.
+	Buffer() []byte
+
+	//Len returns the number of samples in which the data could be encoded.
+	Len() int
+
+	//Offset returns the offset in the buffer of the sample with given index, from 0 to Len() - 1.
+	//The data is encoded in the samples in the order of their indices, unless it is scattered with a key.
+	Offset(i int) int
+
+	//Encode encodes the carrier with the current samples in its format and writes it to w.
+	Encode(w io.Writer) error
+}
+
+//CarrierFormat describes a format of carriers, see RegisterCarrierFormat.
+type CarrierFormat struct {
+	//Name is the name of the format, e.g. "png".
+	Name string
+
+	//Magic is the prefix identifying the carriers of the format. Each '?' in it matches any byte.
+	Magic string
+
+	//Decode decodes a carrier read from r according to the options.
+	Decode func(r io.Reader, opts *Options) (Carrier, error)
+
+	//Samples returns the number of samples of a carrier read from r according to the options,
+	//as returned by the Len method of the decoded carrier, preferably without decoding all of it.
+	Samples func(r io.Reader, opts *Options) (int, error)
+}
+
+var (
+	carrierFormatsMu sync.RWMutex
+	carrierFormats   []CarrierFormat
+)
+
+//RegisterCarrierFormat registers a format of carriers, so the carriers starting with its magic could be encoded and decoded.
+//A format registered later takes precedence over the formats registered before it, so the built-in ones could be replaced.
+//Carriers not matching any of the registered formats are decoded as images in any of the formats registered with the image package.
+func RegisterCarrierFormat(format CarrierFormat) {
+	carrierFormatsMu.Lock()
+	defer carrierFormatsMu.Unlock()
+	carrierFormats = append(carrierFormats, format)
+}
+
+//sniffCarrierFormat returns the format of the carrier read from r along with reader of the whole carrier,
+//as some of it is read in order to detect the format.
+func sniffCarrierFormat(r io.Reader) (CarrierFormat, io.Reader) {
+	br := bufio.NewReader(r)
+
+	carrierFormatsMu.RLock()
+	defer carrierFormatsMu.RUnlock()
+	for i := len(carrierFormats) - 1; i >= 0; i-- {
+		f := carrierFormats[i]
+		prefix, err := br.Peek(len(f.Magic))
+		if err == nil && matchMagic(f.Magic, prefix) {
+			return f, br
+		}
+	}
+	return imageCarrierFormat, br
+}
+
+func matchMagic(magic string, prefix []byte) bool {
+	for i, b := range prefix {
+		if magic[i] != b && magic[i] != '?' {
+			return false
+		}
+	}
+	return true
+}
+
+//decodeCarrier decodes the carrier read from r according to the options in the format it is detected to be in.
+//If the carrier is encoded, it is a result of encoding, so it is decoded with its format as the result format, see Options.Format.
+//Otherwise it is a carrier to encode, so its size is not limited, see Options.MaxPixels.
+func decodeCarrier(r io.Reader, opts *Options, encoded bool) (Carrier, error) {
+	format, r := sniffCarrierFormat(r)
+	carrierOpts := *opts
+	if encoded {
+		carrierOpts.Format = format.Name
+	} else {
+		carrierOpts.MaxPixels = -1
+	}
+	carrier, err := format.Decode(r, &carrierOpts)
+	var unsupported dct.UnsupportedError
+	if encoded && errors.As(err, &unsupported) { // results of encoding are always supported
+		return nil, ErrNoPayload
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing carrier: %v", err)
+	}
+	return carrier, nil
+}
+
+//carrierSamples returns the number of samples of the carrier read from r according to the options.
+//It is a carrier to encode, so its size is not limited, see Options.MaxPixels.
+func carrierSamples(r io.Reader, opts *Options) (int, error) {
+	format, r := sniffCarrierFormat(r)
+	carrierOpts := *opts
+	carrierOpts.MaxPixels = -1
+	return format.Samples(r, &carrierOpts)
+}
@@ -0,0 +1,95 @@
+package steg_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/DimitarPetrov/stegify/steg"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+const rawMagic = "RAW?"
+
+//rawCarrier is a carrier of a trivial format, which is the magic followed by the samples.
+type rawCarrier struct {
+	samples []byte
+}
+
+func decodeRawCarrier(r io.Reader, _ *steg.Options) (steg.Carrier, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < len(rawMagic) {
+		return nil, fmt.Errorf("raw carrier truncated")
+	}
+	return &rawCarrier{samples: b[len(rawMagic):]}, nil
+}
+
+func (c *rawCarrier) Buffer() []byte   { return c.samples }
+func (c *rawCarrier) Len() int         { return len(c.samples) }
+func (c *rawCarrier) Offset(i int) int { return i }
+func (c *rawCarrier) Encode(w io.Writer) error {
+	if _, err := io.WriteString(w, "RAW1"); err != nil {
+		return err
+	}
+	_, err := w.Write(c.samples)
+	return err
+}
+
+func init() {
+	steg.RegisterCarrierFormat(steg.CarrierFormat{
+		Name:   "raw",
+		Magic:  rawMagic,
+		Decode: decodeRawCarrier,
+		Samples: func(r io.Reader, opts *steg.Options) (int, error) {
+			c, err := decodeRawCarrier(r, opts)
+			if err != nil {
+				return 0, err
+			}
+			return c.Len(), nil
+		},
+	})
+}
+
+func TestEncodeShouldUseRegisteredCarrierFormat(t *testing.T) {
+	carrier := append([]byte("RAW0"), make([]byte, 4096)...)
+	data := []byte("hidden in a carrier of a registered format")
+	var tests = []struct {
+		name string
+		opts *steg.Options
+	}{
+		{name: "Default options"},
+		{name: "Scattered", opts: &steg.Options{Key: []byte("key"), Depth: 1}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			capacity, err := steg.Capacity(bytes.NewReader(carrier), test.opts)
+			if err != nil {
+				t.Fatalf("Error calculating capacity: %v", err)
+			}
+			if capacity < len(data) {
+				t.Fatalf("Expected capacity of at least %d bytes but got %d", len(data), capacity)
+			}
+
+			var result bytes.Buffer
+			if err := steg.NewEncoder(steg.WithOptions(test.opts)).Encode(context.Background(), bytes.NewReader(carrier), bytes.NewReader(data), &result); err != nil {
+				t.Fatalf("Error encoding data: %v", err)
+			}
+			if !bytes.HasPrefix(result.Bytes(), []byte("RAW1")) || result.Len() != len(carrier) {
+				t.Fatalf("Expected result in the format of the carrier")
+			}
+
+			var decoded bytes.Buffer
+			if _, err := steg.NewDecoder(steg.WithOptions(test.opts)).Decode(context.Background(), &result, &decoded); err != nil {
+				t.Fatalf("Error decoding data: %v", err)
+			}
+			if !bytes.Equal(decoded.Bytes(), data) {
+				t.Errorf("Decoded data does not match the original")
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package steg
+
+import (
+	"fmt"
+	"strings"
+)
+
+//Channels is a set of color channels of the carrier pixels in which the data is encoded.
+type Channels byte
+
+//Color channels which could be combined in a set of Channels.
+const (
+	Red Channels = 1 << iota
+	Green
+	Blue
+
+	AllChannels = Red | Green | Blue
+)
+
+var channelNames = []struct {
+	channel Channels
+	name    string
+}{
+	{Red, "R"},
+	{Green, "G"},
+	{Blue, "B"},
+}
+
+func (c Channels) String() string {
+	if c&^AllChannels != 0 {
+		return fmt.Sprintf("Channels(%d)", byte(c))
+	}
+	var name strings.Builder
+	for _, n := range channelNames {
+		if c&n.channel != 0 {
+			name.WriteString(n.name)
+		}
+	}
+	return name.String()
+}
+
+//ParseChannels returns the set of channels with given name, as returned by its String method, e.g. "RGB" or "RB".
+func ParseChannels(name string) (Channels, error) {
+	var c Channels
+	for _, r := range strings.ToUpper(name) {
+		i := strings.IndexRune("RGB", r)
+		if i < 0 || c&channelNames[i].channel != 0 {
+			return 0, fmt.Errorf("unsupported channels %s", name)
+		}
+		c |= channelNames[i].channel
+	}
+	if c == 0 {
+		return 0, fmt.Errorf("unsupported channels %s", name)
+	}
+	return c, nil
+}
+
+//offsets returns the offsets within a pixel of the RGBA Pix buffer of the channels in the set, in order.
+//The zero value stands for all channels.
+func (c Channels) offsets() ([]int, error) {
+	if c == 0 {
+		c = AllChannels
+	}
+	if c&^AllChannels != 0 {
+		return nil, fmt.Errorf("unsupported channels %v", c)
+	}
+	offsets := make([]int, 0, len(channelNames))
+	for i, n := range channelNames {
+		if c&n.channel != 0 {
+			offsets = append(offsets, i)
+		}
+	}
+	return offsets, nil
+}
@@ -0,0 +1,218 @@
+package steg
+
+import (
+	"crypto/rand"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const setIDSize = 8
+
+//chunkInfo identifies a chunk of data encoded in one of the carriers of a set produced by MultiCarrierEncode.
+type chunkInfo struct {
+	setID     [setIDSize]byte
+	index     uint16
+	count     uint16
+	parity    uint16 // number of parity chunks of the set, the data chunks come first
+	setLength uint64 // length of the data of the whole set, recorded only when the set has parity chunks
+	threshold uint16 // number of chunks required for decoding, if the chunks are secret shares of the whole data
+}
+
+//chunk is a chunk of data decoded from one of the carriers of a set.
+type chunk struct {
+	header header
+	data   []byte
+}
+
+//MissingChunksError is returned by the multi carrier decoding functions when some of the carriers of a set are not given.
+type MissingChunksError struct {
+	Indices  []int // indices of the missing chunks, in the order of the carriers when encoding
+	Count    int   // total number of chunks in the set
+	Required int   // number of chunks required for decoding, less than Count if the set has parity chunks
+}
+
+func (e *MissingChunksError) Error() string {
+	indices := make([]string, 0, len(e.Indices))
+	for _, i := range e.Indices {
+		indices = append(indices, strconv.Itoa(i))
+	}
+	msg := fmt.Sprintf("missing %d of %d chunks with indices %s", len(e.Indices), e.Count, strings.Join(indices, ", "))
+	if e.Required < e.Count {
+		msg += fmt.Sprintf(", at least %d chunks are required", e.Required)
+	}
+	return msg
+}
+
+func newSetID() ([setIDSize]byte, error) {
+	var setID [setIDSize]byte
+	if _, err := rand.Read(setID[:]); err != nil {
+		return setID, fmt.Errorf("error generating set id: %v", err)
+	}
+	return setID, nil
+}
+
+//chunkTemplate returns information about a chunk of a set of given number of carriers encoded with given options,
+//with the set specific fields left unset, or nil if the whole data is encoded in a single carrier.
+func chunkTemplate(carriers int, opts *Options) *chunkInfo {
+	if carriers <= 1 {
+		return nil
+	}
+	return &chunkInfo{parity: uint16(opts.Parity), threshold: uint16(opts.Threshold)}
+}
+
+//splitData splits data in chunks to be encoded in carriers with given capacities.
+//By default the chunks are proportional to the capacities. With parity the data is split in equally sized shards,
+//limited by the smallest capacity, followed by parity shards, so any len(capacities) - parity of the chunks are enough for decoding.
+//With threshold every chunk is a secret share of the whole data, so any threshold of the chunks are enough for decoding.
+func splitData(data []byte, capacities []int, opts *Options) ([][]byte, error) {
+	switch {
+	case opts.Parity != 0:
+		if total := redundantCapacity(capacities, opts); len(data) > total {
+			return nil, fmt.Errorf("data file too large for these carriers, total capacity with %d parity carriers is %d bytes", opts.Parity, total)
+		}
+		return encodeShards(data, len(capacities)-opts.Parity, opts.Parity), nil
+	case opts.Threshold != 0:
+		if total := redundantCapacity(capacities, opts); len(data) > total {
+			return nil, fmt.Errorf("data file too large for these carriers, every share is limited to %d bytes", total)
+		}
+		return splitShares(data, len(capacities), opts.Threshold)
+	}
+
+	sizes, err := splitByCapacity(len(data), capacities)
+	if err != nil {
+		return nil, err
+	}
+	chunks := make([][]byte, 0, len(sizes))
+	offset := 0
+	for _, size := range sizes {
+		chunks = append(chunks, data[offset:offset+size])
+		offset += size
+	}
+	return chunks, nil
+}
+
+//validateRedundancy checks that the parity or threshold options are applicable to a set of given number of carriers.
+func validateRedundancy(carriers int, opts *Options) error {
+	if opts.Parity < 0 {
+		return fmt.Errorf("invalid number of parity carriers %d", opts.Parity)
+	}
+	if opts.Threshold < 0 {
+		return fmt.Errorf("invalid threshold %d", opts.Threshold)
+	}
+	switch {
+	case opts.Parity != 0 && opts.Threshold != 0:
+		return fmt.Errorf("parity and threshold could not be combined")
+	case opts.Parity != 0:
+		if opts.Parity >= carriers {
+			return fmt.Errorf("%d parity carriers require at least %d carriers", opts.Parity, opts.Parity+1)
+		}
+		if carriers > maxShards {
+			return fmt.Errorf("too many carriers, at most %d are supported with parity", maxShards)
+		}
+	case opts.Threshold != 0:
+		if opts.Threshold < 2 || opts.Threshold > carriers {
+			return fmt.Errorf("unsupported threshold %d, it should be between 2 and the number of carriers", opts.Threshold)
+		}
+		if carriers > maxShares {
+			return fmt.Errorf("too many carriers, at most %d are supported with threshold", maxShares)
+		}
+	}
+	return nil
+}
+
+//redundantCapacity returns the maximum length of data which could be encoded with parity or threshold in carriers with given capacities.
+func redundantCapacity(capacities []int, opts *Options) int {
+	smallest := capacities[0]
+	for _, capacity := range capacities {
+		if capacity < smallest {
+			smallest = capacity
+		}
+	}
+	if opts.Threshold != 0 {
+		return smallest
+	}
+	return smallest * (len(capacities) - opts.Parity)
+}
+
+//joinChunks returns the data of a set of chunks, reconstructing the missing ones from the parity chunks
+//or combining the secret shares if possible.
+//All chunks should be from the same set.
+//Chunks without set information are joined in the given order only when decoded as legacy,
+//otherwise they could be from unrelated carriers, so only a single one of them is accepted.
+func joinChunks(chunks []chunk, opts *Options) ([]byte, error) {
+	withInfo := 0
+	for _, c := range chunks {
+		if c.header.flags&flagChunk != 0 {
+			withInfo++
+		}
+	}
+	if withInfo == 0 {
+		if len(chunks) > 1 && !opts.Legacy {
+			return nil, fmt.Errorf("carriers from different sets given")
+		}
+		var data []byte
+		for _, c := range chunks {
+			data = append(data, c.data...)
+		}
+		return data, nil
+	}
+	if withInfo != len(chunks) {
+		return nil, fmt.Errorf("carriers from different sets given")
+	}
+
+	first := chunks[0].header.chunk
+	if first.parity >= first.count {
+		return nil, fmt.Errorf("invalid number of parity chunks %d of %d chunks", first.parity, first.count)
+	}
+	if first.threshold > first.count {
+		return nil, fmt.Errorf("invalid threshold %d of %d chunks", first.threshold, first.count)
+	}
+	shards := make([][]byte, first.count)
+	found := make([]bool, first.count)
+	for _, c := range chunks {
+		info := c.header.chunk
+		if info.setID != first.setID || info.count != first.count || info.parity != first.parity || info.setLength != first.setLength || info.threshold != first.threshold {
+			return nil, fmt.Errorf("carriers from different sets given")
+		}
+		if info.index >= info.count {
+			return nil, fmt.Errorf("invalid chunk index %d of %d chunks", info.index, info.count)
+		}
+		if found[info.index] {
+			return nil, fmt.Errorf("chunk with index %d given more than once", info.index)
+		}
+		shards[info.index] = c.data
+		if c.data == nil { // nil marks missing shards
+			shards[info.index] = []byte{}
+		}
+		found[info.index] = true
+	}
+
+	var missing []int
+	for i, ok := range found {
+		if !ok {
+			missing = append(missing, i)
+		}
+	}
+	required := int(first.count - first.parity)
+	if first.threshold != 0 {
+		required = int(first.threshold)
+	}
+	if len(chunks) < required {
+		sort.Ints(missing)
+		return nil, &MissingChunksError{Indices: missing, Count: int(first.count), Required: required}
+	}
+
+	switch {
+	case first.parity != 0:
+		return reconstructData(shards, required, first.setLength)
+	case first.threshold != 0:
+		return combineShares(shards, required)
+	}
+	var data []byte
+	for _, shard := range shards {
+		data = append(data, shard...)
+	}
+	return data, nil
+}
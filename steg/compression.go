@@ -0,0 +1,85 @@
+package steg
+
+import (
+	"compress/flate"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+//Compression is an algorithm compressing the data before encoding it.
+type Compression byte
+
+//Supported compression algorithms.
+const (
+	NoCompression Compression = iota
+	Deflate                   // DEFLATE with the best compression level
+)
+
+var compressionNames = map[Compression]string{
+	NoCompression: "none",
+	Deflate:       "deflate",
+}
+
+func (c Compression) String() string {
+	if name, ok := compressionNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("Compression(%d)", byte(c))
+}
+
+//ParseCompression returns the compression algorithm with given name, as returned by its String method.
+func ParseCompression(name string) (Compression, error) {
+	for c, n := range compressionNames {
+		if n == name {
+			return c, nil
+		}
+	}
+	return NoCompression, fmt.Errorf("unsupported compression %s", name)
+}
+
+func (c Compression) supported() bool {
+	_, ok := compressionNames[c]
+	return ok
+}
+
+//compress returns reader of data compressed with c. It should be closed to release the resources used by the compression.
+func compress(data io.Reader, c Compression) io.ReadCloser {
+	if c == NoCompression {
+		return ioutil.NopCloser(data)
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		fw, err := flate.NewWriter(pw, flate.BestCompression)
+		if err == nil {
+			_, err = io.Copy(fw, data)
+		}
+		if err == nil {
+			err = fw.Close()
+		}
+		pw.CloseWithError(err) // a nil error closes the pipe with io.EOF
+	}()
+	return pr
+}
+
+//newDecompressor returns reader of data compressed with c, decompressing it as it is read.
+func newDecompressor(data io.Reader, c Compression) io.Reader {
+	if c == NoCompression {
+		return data
+	}
+	return &decompressor{flate.NewReader(data)}
+}
+
+//decompressor wraps the errors of a decompressing reader.
+type decompressor struct {
+	r io.Reader
+}
+
+func (d *decompressor) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = fmt.Errorf("error decompressing data: %w", err)
+	}
+	return n, err
+}
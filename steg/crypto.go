@@ -0,0 +1,87 @@
+package steg
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	saltSize      = 16
+	nonceSize     = 12 // standard AES-GCM nonce size
+	sealOverhead  = 16 // AES-GCM authentication tag
+	kdfIterations = 600000
+)
+
+//ErrPasswordRequired is returned by the decoding functions when the encoded data is encrypted, but no password is given.
+var ErrPasswordRequired = errors.New("encoded data is encrypted, password required")
+
+//ErrWrongPassword is returned by the decoding functions when the encoded data could not be decrypted
+//with the given password, either because the password is wrong or the data was tampered with.
+var ErrWrongPassword = errors.New("wrong password or corrupted encrypted data")
+
+//seal encrypts and authenticates data with AES-256-GCM using key derived from the password and newly generated salt.
+func seal(password, data []byte) (salt [saltSize]byte, nonce [nonceSize]byte, sealed []byte, err error) {
+	if _, err = rand.Read(salt[:]); err != nil {
+		return salt, nonce, nil, fmt.Errorf("error generating salt: %v", err)
+	}
+	if _, err = rand.Read(nonce[:]); err != nil {
+		return salt, nonce, nil, fmt.Errorf("error generating nonce: %v", err)
+	}
+
+	aead, err := newAEAD(password, salt)
+	if err != nil {
+		return salt, nonce, nil, err
+	}
+	return salt, nonce, aead.Seal(nil, nonce[:], data, nil), nil
+}
+
+//unseal decrypts and authenticates data previously sealed with the same password.
+func unseal(password []byte, salt [saltSize]byte, nonce [nonceSize]byte, sealed []byte) ([]byte, error) {
+	aead, err := newAEAD(password, salt)
+	if err != nil {
+		return nil, err
+	}
+	data, err := aead.Open(nil, nonce[:], sealed, nil)
+	if err != nil {
+		return nil, ErrWrongPassword
+	}
+	return data, nil
+}
+
+func newAEAD(password []byte, salt [saltSize]byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(deriveKey(password, salt[:]))
+	if err != nil {
+		return nil, fmt.Errorf("error creating cipher: %v", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+//deriveKey derives a 256-bit key from the password using PBKDF2 with HMAC-SHA256 (RFC 8018).
+//The key is exactly one block of the underlying hash, so only the first block is computed.
+func deriveKey(password, salt []byte) []byte {
+	prf := hmac.New(sha256.New, password)
+
+	blockIndex := make([]byte, 4)
+	binary.BigEndian.PutUint32(blockIndex, 1)
+	prf.Write(salt)
+	prf.Write(blockIndex)
+	u := prf.Sum(nil)
+
+	key := make([]byte, len(u))
+	copy(key, u)
+	for i := 1; i < kdfIterations; i++ {
+		prf.Reset()
+		prf.Write(u)
+		u = prf.Sum(u[:0])
+		for j := range key {
+			key[j] ^= u[j]
+		}
+	}
+	return key
+}
@@ -0,0 +1,180 @@
+package steg
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	defaultResultName = "result"
+	maxFileInfoString = 255 // names and content types are prefixed with their length (1)
+)
+
+//File info record flags.
+const (
+	fileInfoArchive byte = 1 << iota // the data is a tar archive
+)
+
+//FileInfo describes the original data file. It is recorded alongside the data when encoding,
+//so the decoding functions could restore the file under its original name.
+type FileInfo struct {
+	Name        string      // base name of the file
+	Mode        os.FileMode // permission bits of the file
+	ModTime     time.Time   // modification time of the file, the zero value if unknown
+	ContentType string      // MIME type of the data, detected from its content if empty when encoding
+	Archive     bool        // the data is a tar archive of multiple files or directories, extracted when decoding to files
+}
+
+//newFileInfo returns the information about the file described by stat.
+func newFileInfo(stat os.FileInfo) *FileInfo {
+	return &FileInfo{
+		Name:    stat.Name(),
+		Mode:    stat.Mode().Perm(),
+		ModTime: stat.ModTime(),
+	}
+}
+
+//baseName returns the name under which the file should be restored. It is stripped of any directories,
+//so a crafted carrier could not make the decoding functions write outside of the output directory.
+func (info *FileInfo) baseName() string {
+	if info == nil {
+		return defaultResultName
+	}
+	name := path.Base(strings.Replace(info.Name, "\\", "/", -1))
+	if name == "." || name == ".." || name == "/" {
+		return defaultResultName
+	}
+	return name
+}
+
+//restore sets the permissions and the modification time of the file with given name to the recorded ones.
+func (info *FileInfo) restore(fileName string) error {
+	if info == nil {
+		return nil
+	}
+	if info.Mode.Perm() != 0 {
+		if err := os.Chmod(fileName, info.Mode.Perm()); err != nil {
+			return fmt.Errorf("error restoring permissions of result file: %v", err)
+		}
+	}
+	if !info.ModTime.IsZero() {
+		if err := os.Chtimes(fileName, info.ModTime, info.ModTime); err != nil {
+			return fmt.Errorf("error restoring modification time of result file: %v", err)
+		}
+	}
+	return nil
+}
+
+//prependFileInfo returns data preceded by the record of info. The content type is detected from data if not set.
+func prependFileInfo(data io.Reader, info *FileInfo) (io.Reader, error) {
+	record := *info
+	if record.ContentType == "" {
+		buffered := bufio.NewReaderSize(data, 512)
+		head, err := buffered.Peek(512) // all that http.DetectContentType considers
+		if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+			return nil, fmt.Errorf("error reading data %v", err)
+		}
+		record.ContentType = http.DetectContentType(head)
+		data = buffered
+	}
+
+	recordBytes, err := record.marshal()
+	if err != nil {
+		return nil, err
+	}
+	return io.MultiReader(bytes.NewReader(recordBytes), data), nil
+}
+
+//marshal returns the record of the file info: its length (2) + permissions (4) + modification time in nanoseconds since the epoch (8)
+//+ name length (1) + name + content type length (1) + content type + flags (1).
+func (info *FileInfo) marshal() ([]byte, error) {
+	if len(info.Name) > maxFileInfoString {
+		return nil, fmt.Errorf("file name %s too long, at most %d bytes are supported", info.Name, maxFileInfoString)
+	}
+	if len(info.ContentType) > maxFileInfoString {
+		return nil, fmt.Errorf("content type %s too long, at most %d bytes are supported", info.ContentType, maxFileInfoString)
+	}
+
+	var modTime int64
+	if !info.ModTime.IsZero() {
+		modTime = info.ModTime.UnixNano()
+	}
+
+	bs := make([]byte, 15, 15+len(info.Name)+1+len(info.ContentType)+1)
+	binary.LittleEndian.PutUint16(bs, uint16(cap(bs)-2))
+	binary.LittleEndian.PutUint32(bs[2:], uint32(info.Mode.Perm()))
+	binary.LittleEndian.PutUint64(bs[6:], uint64(modTime))
+	bs[14] = byte(len(info.Name))
+	bs = append(bs, info.Name...)
+	bs = append(bs, byte(len(info.ContentType)))
+	bs = append(bs, info.ContentType...)
+	var flags byte
+	if info.Archive {
+		flags |= fileInfoArchive
+	}
+	bs = append(bs, flags)
+	return bs, nil
+}
+
+//readFileInfo reads the file info recorded in front of the data described by h, if any, leaving data at the bytes following it.
+func readFileInfo(h header, data io.Reader) (*FileInfo, error) {
+	if h.flags&flagFileInfo == 0 {
+		return nil, nil
+	}
+
+	var size [2]byte
+	if _, err := io.ReadFull(data, size[:]); err != nil {
+		return nil, fileInfoReadError(err)
+	}
+	record := make([]byte, binary.LittleEndian.Uint16(size[:]))
+	if _, err := io.ReadFull(data, record); err != nil {
+		return nil, fileInfoReadError(err)
+	}
+	return parseFileInfo(record)
+}
+
+func fileInfoReadError(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("file info truncated")
+	}
+	return err
+}
+
+//parseFileInfo parses a file info record without its length.
+func parseFileInfo(record []byte) (*FileInfo, error) {
+	if len(record) < 12 {
+		return nil, fmt.Errorf("file info truncated")
+	}
+	info := &FileInfo{Mode: os.FileMode(binary.LittleEndian.Uint32(record)).Perm()}
+	if modTime := int64(binary.LittleEndian.Uint64(record[4:])); modTime != 0 {
+		info.ModTime = time.Unix(0, modTime)
+	}
+	record = record[12:]
+
+	var ok bool
+	if info.Name, record, ok = readFileInfoString(record); !ok {
+		return nil, fmt.Errorf("file info truncated")
+	}
+	if info.ContentType, record, ok = readFileInfoString(record); !ok {
+		return nil, fmt.Errorf("file info truncated")
+	}
+	if len(record) > 0 {
+		info.Archive = record[0]&fileInfoArchive != 0
+	}
+	return info, nil
+}
+
+func readFileInfoString(bs []byte) (string, []byte, bool) {
+	if len(bs) < 1 || len(bs)-1 < int(bs[0]) {
+		return "", nil, false
+	}
+	return string(bs[1 : 1+bs[0]]), bs[1+bs[0]:], true
+}
@@ -0,0 +1,110 @@
+//go:build go1.18
+// +build go1.18
+
+package steg
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"io"
+	"runtime"
+	"testing"
+)
+
+func FuzzDecode(f *testing.F) {
+	carrier := newFuzzCarrier(f, 16, 16)
+	var encoded bytes.Buffer
+	if err := EncodeWithOptions(bytes.NewReader(carrier), bytes.NewReader([]byte("fuzz")), &encoded, &Options{Compression: Deflate}); err != nil {
+		f.Fatalf("Error encoding seed: %v", err)
+	}
+	f.Add(encoded.Bytes(), false)
+	f.Add(carrier, true)
+	f.Add([]byte{}, false)
+
+	bomb := []*bytes.Buffer{{}, {}} // a chunk with parity is decoded in memory before it is decompressed
+	err := MultiCarrierEncodeWithOptions([]io.Reader{bytes.NewReader(newFuzzCarrier(f, 512, 64)), bytes.NewReader(newFuzzCarrier(f, 512, 64))},
+		bytes.NewReader(make([]byte, 1<<24+1<<22)), []io.Writer{bomb[0], bomb[1]}, &Options{Compression: Deflate, Parity: 1})
+	if err != nil {
+		f.Fatalf("Error encoding seed: %v", err)
+	}
+	f.Add(bomb[0].Bytes(), false)
+
+	f.Fuzz(func(t *testing.T, carrier []byte, legacy bool) {
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		var written countingWriter
+		opts := &Options{Legacy: legacy, MaxPixels: 1 << 16} // keep the memory used for hostile image sizes low
+		_, _ = decodeStream(newTask(context.Background(), opts), []io.Reader{bytes.NewReader(carrier)}, &written, opts)
+		runtime.ReadMemStats(&after)
+
+		if allocated := after.TotalAlloc - before.TotalAlloc; written > 1<<24 && allocated > uint64(written)/2 {
+			t.Errorf("Allocated %d bytes decoding %d bytes of data, which should be decompressed as it is written", allocated, written)
+		}
+	})
+}
+
+//countingWriter counts the bytes written to it.
+type countingWriter int64
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	*w += countingWriter(len(p))
+	return len(p), nil
+}
+
+func FuzzExtractHeader(f *testing.F) {
+	h := header{version: headerVersion, flags: supportedFlags, depth: 3, compression: Deflate, chunk: chunkInfo{count: 2, parity: 1}}
+	f.Add(padPix(bits4(h.marshal())), uint8(1)) // a single column, as the slots are ordered column by column
+	f.Add([]byte{}, uint8(1))
+
+	f.Fuzz(func(t *testing.T, pix []byte, width uint8) {
+		if width == 0 {
+			return
+		}
+		img := &image.RGBA{Pix: padPix(pix), Stride: 4 * int(width)}
+		img.Rect = image.Rect(0, 0, int(width), len(img.Pix)/img.Stride)
+		if img.Rect.Dy() == 0 {
+			return
+		}
+		carrierSlots := newTestSlots(t, img, nil, AllChannels)
+
+		if h, err := extractHeader(carrierSlots); err == nil && h.size() > carrierSlots.count/4 {
+			t.Errorf("Extracted header of %d bytes from %d slots", h.size(), carrierSlots.count)
+		}
+		if count, ok := extractLegacyDataCount(carrierSlots); ok && count < 0 {
+			t.Errorf("Extracted negative data count %d", count)
+		}
+	})
+}
+
+//newFuzzCarrier returns an opaque black PNG image, as the color channels of transparent pixels are not preserved.
+func newFuzzCarrier(f *testing.F, w, h int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 0xff
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		f.Fatalf("Error encoding carrier: %v", err)
+	}
+	return buf.Bytes()
+}
+
+//bits4 spreads every byte in the last two bits of four bytes, as the header is encoded in the color channels.
+func bits4(bs []byte) []byte {
+	spread := make([]byte, 0, len(bs)*4)
+	for _, b := range bs {
+		spread = append(spread, b>>6, b>>4&3, b>>2&3, b&3)
+	}
+	return spread
+}
+
+//padPix pads the color channels given as R, G, B with alpha, so they form pixels of an RGBA image.
+func padPix(channels []byte) []byte {
+	pix := make([]byte, 0, len(channels)/3*4+4)
+	for i := 0; i+3 <= len(channels); i += 3 {
+		pix = append(pix, channels[i], channels[i+1], channels[i+2], 0xff)
+	}
+	return pix
+}
@@ -0,0 +1,87 @@
+package steg
+
+import "fmt"
+
+//Arithmetic in the Galois field GF(2^8) with reducing polynomial x^8 + x^4 + x^3 + x^2 + 1 and generator 2.
+//Addition and subtraction are both XOR.
+
+var gfExp [510]byte // doubled, so the sum of two logarithms could be looked up without reduction
+var gfLog [256]byte
+
+func init() {
+	x := 1
+	for i := 0; i < 255; i++ {
+		gfExp[i] = byte(x)
+		gfLog[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+	for i := 255; i < len(gfExp); i++ {
+		gfExp[i] = gfExp[i-255]
+	}
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+//gfInv returns the multiplicative inverse of a, which must not be zero.
+func gfInv(a byte) byte {
+	return gfExp[255-int(gfLog[a])]
+}
+
+//gfMulSlice adds c * src to dst element-wise.
+func gfMulSlice(c byte, src, dst []byte) {
+	if c == 0 {
+		return
+	}
+	logC := int(gfLog[c])
+	for i, s := range src {
+		if s != 0 {
+			dst[i] ^= gfExp[logC+int(gfLog[s])]
+		}
+	}
+}
+
+//gfInvertMatrix returns the inverse of the square matrix m using Gauss-Jordan elimination. The matrix m is not modified.
+func gfInvertMatrix(m [][]byte) ([][]byte, error) {
+	n := len(m)
+	work := make([][]byte, n) // m augmented with the identity matrix
+	for i := range m {
+		work[i] = make([]byte, 2*n)
+		copy(work[i], m[i])
+		work[i][n+i] = 1
+	}
+
+	for col := 0; col < n; col++ {
+		pivot := col
+		for pivot < n && work[pivot][col] == 0 {
+			pivot++
+		}
+		if pivot == n {
+			return nil, fmt.Errorf("singular matrix")
+		}
+		work[col], work[pivot] = work[pivot], work[col]
+
+		inv := gfInv(work[col][col])
+		for j := range work[col] {
+			work[col][j] = gfMul(work[col][j], inv)
+		}
+		for row := 0; row < n; row++ {
+			if row != col && work[row][col] != 0 {
+				gfMulSlice(work[row][col], work[col], work[row])
+			}
+		}
+	}
+
+	inverse := make([][]byte, n)
+	for i := range work {
+		inverse[i] = work[i][n:]
+	}
+	return inverse, nil
+}
@@ -0,0 +1,285 @@
+package steg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	headerVersion    = 2
+	headerPrefixSize = 14 // magic (4) + version (1) + flags (1) + data length (8)
+	headerDepth      = 2  // the header is always encoded in the last two bits of the color channels
+)
+
+//Version 1 headers differ only in the size of the lengths, which are 32-bit instead of 64-bit.
+const headerV1 = 1
+
+//Header flags marking the presence of optional header fields, which follow the prefix in the order of the flags.
+const (
+	flagChecksum   byte = 1 << iota // CRC-32 (IEEE) of the data (4)
+	flagEncrypted                   // salt (16) + nonce (12) of the AES-GCM sealed data
+	flagDepth                       // number of bits of every color channel holding data (1), defaultDepth if missing
+	flagChunk                       // set id (8) + chunk index (2) + chunks count (2) of data split in multiple carriers
+	flagParity                      // parity chunks count (2) + data length of the whole set (8), requires flagChunk
+	flagShares                      // threshold of the secret shares (2), requires flagChunk
+	flagFileInfo                    // no field, the data of the whole set starts with a record of the original file info
+	flagCompressed                  // compression algorithm of the data of the whole set (1)
+
+	supportedFlags = flagChecksum | flagEncrypted | flagDepth | flagChunk | flagParity | flagShares | flagFileInfo | flagCompressed
+)
+
+var headerMagic = [4]byte{'S', 'T', 'G', 'Y'}
+
+//ErrNoPayload is returned by the decoding functions when the carrier does not contain data encoded by stegify.
+var ErrNoPayload = errors.New("no stegify payload found in carrier")
+
+//ErrChecksumMismatch is returned by the decoding functions when the decoded data does not match the checksum
+//recorded while encoding, e.g. because the carrier was recompressed, resized or truncated.
+var ErrChecksumMismatch = errors.New("decoded data does not match its checksum")
+
+//LengthExceedsCapacityError is returned by the decoding functions when the length of the data recorded in the carrier
+//exceeds the number of bytes the carrier could hold, e.g. because the carrier was crafted or damaged.
+//The length is validated before any memory is allocated for the data.
+type LengthExceedsCapacityError struct {
+	Length   uint64 // recorded length of the data in bytes
+	Capacity uint64 // number of bytes the carrier could hold after the header
+}
+
+func (e *LengthExceedsCapacityError) Error() string {
+	return fmt.Sprintf("payload length of %d bytes exceeds the capacity of the carrier of %d bytes", e.Length, e.Capacity)
+}
+
+//header describes the payload encoded in a carrier. It is written in the first pixels of the carrier.
+type header struct {
+	version     byte
+	flags       byte
+	dataLength  uint64 // in bytes
+	checksum    uint32
+	salt        [saltSize]byte
+	nonce       [nonceSize]byte
+	depth       byte
+	chunk       chunkInfo
+	compression Compression
+}
+
+//newHeader returns header describing data encoded with given options, which is optionally a chunk of data split in multiple carriers.
+//The data length, checksum and encryption parameters are left unset.
+func newHeader(opts *Options, chunk *chunkInfo) (header, error) {
+	depth := opts.depth()
+	if depth < 1 || depth > 4 {
+		return header{}, fmt.Errorf("unsupported depth %d, it should be between 1 and 4", depth)
+	}
+
+	h := header{
+		version: headerVersion,
+		flags:   flagChecksum,
+		depth:   byte(depth),
+	}
+	if len(opts.Password) != 0 {
+		h.flags |= flagEncrypted
+	}
+	if depth != defaultDepth {
+		h.flags |= flagDepth
+	}
+	if opts.FileInfo != nil {
+		h.flags |= flagFileInfo
+	}
+	if !opts.Compression.supported() {
+		return header{}, fmt.Errorf("unsupported compression %v", opts.Compression)
+	}
+	if opts.Compression != NoCompression {
+		h.flags |= flagCompressed
+		h.compression = opts.Compression
+	}
+	if chunk != nil {
+		h.flags |= flagChunk
+		h.chunk = *chunk
+		if chunk.parity != 0 {
+			h.flags |= flagParity
+		}
+		if chunk.threshold != 0 {
+			h.flags |= flagShares
+		}
+	}
+	return h, nil
+}
+
+//lengthSize returns the size of the lengths in the header.
+func (h header) lengthSize() int {
+	if h.version == headerV1 {
+		return 4
+	}
+	return 8
+}
+
+func (h header) prefixSize() int {
+	return 6 + h.lengthSize()
+}
+
+func (h header) size() int {
+	size := h.prefixSize()
+	if h.flags&flagChecksum != 0 {
+		size += 4
+	}
+	if h.flags&flagEncrypted != 0 {
+		size += saltSize + nonceSize
+	}
+	if h.flags&flagDepth != 0 {
+		size++
+	}
+	if h.flags&flagChunk != 0 {
+		size += setIDSize + 4
+	}
+	if h.flags&flagParity != 0 {
+		size += 2 + h.lengthSize()
+	}
+	if h.flags&flagShares != 0 {
+		size += 2
+	}
+	if h.flags&flagCompressed != 0 {
+		size++
+	}
+	return size
+}
+
+func (h header) marshal() []byte {
+	bs := make([]byte, h.size())
+	copy(bs, headerMagic[:])
+	bs[4] = h.version
+	bs[5] = h.flags
+	putLength(bs[6:], h.dataLength, h.lengthSize())
+	offset := h.prefixSize()
+	if h.flags&flagChecksum != 0 {
+		binary.LittleEndian.PutUint32(bs[offset:], h.checksum)
+		offset += 4
+	}
+	if h.flags&flagEncrypted != 0 {
+		offset += copy(bs[offset:], h.salt[:])
+		offset += copy(bs[offset:], h.nonce[:])
+	}
+	if h.flags&flagDepth != 0 {
+		bs[offset] = h.depth
+		offset++
+	}
+	if h.flags&flagChunk != 0 {
+		offset += copy(bs[offset:], h.chunk.setID[:])
+		binary.LittleEndian.PutUint16(bs[offset:], h.chunk.index)
+		binary.LittleEndian.PutUint16(bs[offset+2:], h.chunk.count)
+		offset += 4
+	}
+	if h.flags&flagParity != 0 {
+		binary.LittleEndian.PutUint16(bs[offset:], h.chunk.parity)
+		putLength(bs[offset+2:], h.chunk.setLength, h.lengthSize())
+		offset += 2 + h.lengthSize()
+	}
+	if h.flags&flagShares != 0 {
+		binary.LittleEndian.PutUint16(bs[offset:], h.chunk.threshold)
+		offset += 2
+	}
+	if h.flags&flagCompressed != 0 {
+		bs[offset] = byte(h.compression)
+	}
+	return bs
+}
+
+//unmarshalHeaderPrefix validates the fixed part of a header and returns it.
+//The optional fields are left unset, but the size of the whole header could be determined from the result.
+func unmarshalHeaderPrefix(bs []byte) (header, error) {
+	if len(bs) < 6 || !bytes.Equal(bs[:4], headerMagic[:]) {
+		return header{}, ErrNoPayload
+	}
+
+	h := header{
+		version: bs[4],
+		flags:   bs[5],
+	}
+	if h.version != headerVersion && h.version != headerV1 {
+		return header{}, fmt.Errorf("unsupported payload format version %d", h.version)
+	}
+	if len(bs) < h.prefixSize() {
+		return header{}, ErrNoPayload
+	}
+	h.dataLength = length(bs[6:], h.lengthSize())
+	if h.flags&^supportedFlags != 0 {
+		return header{}, fmt.Errorf("unsupported payload flags %08b", h.flags)
+	}
+	if h.flags&(flagParity|flagShares) != 0 && h.flags&flagChunk == 0 {
+		return header{}, fmt.Errorf("invalid payload flags %08b", h.flags)
+	}
+	return h, nil
+}
+
+func unmarshalHeader(bs []byte) (header, error) {
+	h, err := unmarshalHeaderPrefix(bs)
+	if err != nil {
+		return header{}, err
+	}
+	if len(bs) < h.size() {
+		return header{}, fmt.Errorf("payload header truncated")
+	}
+
+	offset := h.prefixSize()
+	if h.flags&flagChecksum != 0 {
+		h.checksum = binary.LittleEndian.Uint32(bs[offset:])
+		offset += 4
+	}
+	if h.flags&flagEncrypted != 0 {
+		offset += copy(h.salt[:], bs[offset:])
+		offset += copy(h.nonce[:], bs[offset:])
+	}
+	h.depth = defaultDepth
+	if h.flags&flagDepth != 0 {
+		h.depth = bs[offset]
+		if h.depth < 1 || h.depth > 4 {
+			return header{}, fmt.Errorf("unsupported payload depth %d", h.depth)
+		}
+		offset++
+	}
+	if h.flags&flagChunk != 0 {
+		offset += copy(h.chunk.setID[:], bs[offset:])
+		h.chunk.index = binary.LittleEndian.Uint16(bs[offset:])
+		h.chunk.count = binary.LittleEndian.Uint16(bs[offset+2:])
+		offset += 4
+	}
+	if h.flags&flagParity != 0 {
+		h.chunk.parity = binary.LittleEndian.Uint16(bs[offset:])
+		h.chunk.setLength = length(bs[offset+2:], h.lengthSize())
+		offset += 2 + h.lengthSize()
+	}
+	if h.flags&flagShares != 0 {
+		h.chunk.threshold = binary.LittleEndian.Uint16(bs[offset:])
+		offset += 2
+	}
+	if h.flags&flagCompressed != 0 {
+		h.compression = Compression(bs[offset])
+		if h.compression == NoCompression || !h.compression.supported() {
+			return header{}, fmt.Errorf("unsupported payload compression %v", h.compression)
+		}
+	}
+	return h, nil
+}
+
+//putLength writes length in little-endian order in given number of bytes, 4 or 8.
+func putLength(bs []byte, length uint64, size int) {
+	if size == 4 {
+		binary.LittleEndian.PutUint32(bs, uint32(length))
+		return
+	}
+	binary.LittleEndian.PutUint64(bs, length)
+}
+
+//length reads length written by putLength in given number of bytes.
+func length(bs []byte, size int) uint64 {
+	if size == 4 {
+		return uint64(binary.LittleEndian.Uint32(bs))
+	}
+	return binary.LittleEndian.Uint64(bs)
+}
+
+//dataOffset returns the index of the first slot holding data after a header of given size.
+//Every header byte takes four slots (8 / headerDepth) and the data starts from the next whole pixel.
+func dataOffset(headerSize int) int {
+	return (headerSize*4 + 2) / 3 * 3
+}
@@ -0,0 +1,144 @@
+package steg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/DimitarPetrov/stegify/bits"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"reflect"
+	"testing"
+)
+
+func TestHeaderMarshalRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		h    header
+	}{
+		{
+			name: "version 2 with 64-bit lengths",
+			h: header{
+				version:    headerVersion,
+				flags:      flagChecksum | flagChunk | flagParity,
+				dataLength: 5 << 32,
+				checksum:   0xdeadbeef,
+				depth:      defaultDepth,
+				chunk:      chunkInfo{setID: [setIDSize]byte{1, 2, 3}, index: 1, count: 3, parity: 1, setLength: 9 << 32},
+			},
+		},
+		{
+			name: "version 1 with 32-bit lengths",
+			h: header{
+				version:    headerV1,
+				flags:      flagChecksum | flagDepth | flagChunk | flagParity,
+				dataLength: 1 << 31,
+				checksum:   0xdeadbeef,
+				depth:      3,
+				chunk:      chunkInfo{index: 2, count: 4, parity: 2, setLength: 1<<32 - 1},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h, err := unmarshalHeader(test.h.marshal())
+			if err != nil {
+				t.Fatalf("Error unmarshaling header: %v", err)
+			}
+			if !reflect.DeepEqual(h, test.h) {
+				t.Errorf("Expected header %+v but got %+v", test.h, h)
+			}
+		})
+	}
+}
+
+func TestDecodeVersion1Header(t *testing.T) {
+	data := []byte("encoded with version 1 header")
+	carrier := newHeaderTestCarrier(t, header{
+		version:    headerV1,
+		flags:      flagChecksum,
+		dataLength: uint64(len(data)),
+		checksum:   crc32.ChecksumIEEE(data),
+		depth:      defaultDepth,
+	}, data)
+
+	_, decoded, err := decode(newTask(context.Background(), &Options{}), bytes.NewReader(carrier), &Options{})
+	if err != nil {
+		t.Fatalf("Error decoding carrier: %v", err)
+	}
+	if !bytes.Equal(decoded, data) {
+		t.Errorf("Expected data %q but got %q", data, decoded)
+	}
+}
+
+func TestDecodeShouldRejectDataLengthExceedingCapacity(t *testing.T) {
+	carrier := newHeaderTestCarrier(t, header{
+		version:    headerVersion,
+		flags:      flagChecksum,
+		dataLength: 1 << 40,
+		depth:      defaultDepth,
+	}, nil)
+
+	_, _, err := decode(newTask(context.Background(), &Options{}), bytes.NewReader(carrier), &Options{})
+	var lengthErr *LengthExceedsCapacityError
+	if !errors.As(err, &lengthErr) {
+		t.Fatalf("Expected LengthExceedsCapacityError but got: %v", err)
+	}
+	if lengthErr.Length != 1<<40 {
+		t.Errorf("Expected length %d but got %d", uint64(1<<40), lengthErr.Length)
+	}
+	t.Log(err)
+}
+
+func TestDecodeLegacyShouldRejectDataCountExceedingCapacity(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 32, 32))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff // all count bits set
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("Error encoding carrier: %v", err)
+	}
+
+	_, _, err := decode(newTask(context.Background(), &Options{}), &buf, &Options{Legacy: true})
+	var lengthErr *LengthExceedsCapacityError
+	if !errors.As(err, &lengthErr) {
+		t.Fatalf("Expected LengthExceedsCapacityError but got: %v", err)
+	}
+	t.Log(err)
+}
+
+func TestDecodeLegacyShouldNotPanicOnTinyCarrier(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatalf("Error encoding carrier: %v", err)
+	}
+
+	_, _, err := decode(newTask(context.Background(), &Options{}), &buf, &Options{Legacy: true})
+	if !errors.Is(err, ErrNoPayload) {
+		t.Fatalf("Expected ErrNoPayload but got: %v", err)
+	}
+}
+
+//newHeaderTestCarrier returns PNG carrier with given header and data encoded in it.
+func newHeaderTestCarrier(t *testing.T, h header, data []byte) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 32, 32))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	carrierSlots := newTestSlots(t, img, nil, AllChannels)
+
+	setHeader(carrierSlots, bits.SplitBits(h.marshal(), headerDepth))
+	for i, group := range bits.SplitBits(data, uint(h.depth)) {
+		slot := carrierSlots.at(dataOffset(h.size()) + i)
+		*slot = bits.SetLastBits(*slot, group, uint(h.depth))
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("Error encoding carrier: %v", err)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,55 @@
+package steg
+
+import "sync"
+
+//forEach calls f for every index from 0 to n - 1, running at most jobs calls concurrently.
+//The indices are taken in increasing order and no new calls are started after a call fails,
+//so the error returned is the one of the smallest failing index, the same as if the calls were made one after another.
+func forEach(n int, jobs int, f func(i int) error) error {
+	if jobs > n {
+		jobs = n
+	}
+	if jobs <= 1 {
+		for i := 0; i < n; i++ {
+			if err := f(i); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var mu sync.Mutex
+	next, failed := 0, false
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for j := 0; j < jobs; j++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				mu.Lock()
+				if failed || next == n {
+					mu.Unlock()
+					return
+				}
+				i := next
+				next++
+				mu.Unlock()
+
+				if errs[i] = f(i); errs[i] != nil {
+					mu.Lock()
+					failed = true
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
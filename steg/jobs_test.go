@@ -0,0 +1,55 @@
+package steg
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+func TestForEachCallsEveryIndexOnce(t *testing.T) {
+	for _, jobs := range []int{0, 1, 3, 100} {
+		t.Run(fmt.Sprintf("%d jobs", jobs), func(t *testing.T) {
+			calls := make([]int32, 50)
+			var running, maxRunning int32
+			err := forEach(len(calls), jobs, func(i int) error {
+				r := atomic.AddInt32(&running, 1)
+				for {
+					m := atomic.LoadInt32(&maxRunning)
+					if r <= m || atomic.CompareAndSwapInt32(&maxRunning, m, r) {
+						break
+					}
+				}
+				atomic.AddInt32(&calls[i], 1)
+				atomic.AddInt32(&running, -1)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			for i, c := range calls {
+				if c != 1 {
+					t.Errorf("Expected index %d to be processed once but it was processed %d times", i, c)
+				}
+			}
+			if limit := int32(jobs); limit > 0 && maxRunning > limit {
+				t.Errorf("Expected at most %d concurrent calls but got %d", limit, maxRunning)
+			}
+		})
+	}
+}
+
+func TestForEachShouldReturnErrorOfSmallestFailingIndex(t *testing.T) {
+	for _, jobs := range []int{1, 4} {
+		t.Run(fmt.Sprintf("%d jobs", jobs), func(t *testing.T) {
+			err := forEach(20, jobs, func(i int) error {
+				if i == 7 || i == 9 || i == 12 {
+					return fmt.Errorf("error %d", i)
+				}
+				return nil
+			})
+			if err == nil || err.Error() != "error 7" {
+				t.Errorf("Expected error 7 but got %v", err)
+			}
+		})
+	}
+}
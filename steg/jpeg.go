@@ -0,0 +1,108 @@
+package steg
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/DimitarPetrov/stegify/dct"
+	"image"
+	"io"
+)
+
+//maxJPEGDepth is the maximum depth of the data encoded in the DCT coefficients of JPEG carriers,
+//which should not be less than the depth of the header.
+const maxJPEGDepth = headerDepth
+
+//jpegCarrier is a JPEG image carrier, in which the data is encoded in the quantized DCT coefficients of the image,
+//so the result is a baseline JPEG image with the same quantization and Huffman tables.
+//The data is encoded in the least significant bits of the magnitudes of the AC coefficients with magnitude of at least 1<<maxJPEGDepth,
+//keeping their signs. Their magnitude category and thus their Huffman codes never change and they stay large enough to be used,
+//so the coefficients used do not depend on the encoded data. The coefficients are ordered component by component,
+//block by block and in zig-zag order within a block.
+type jpegCarrier struct {
+	img          *dct.Image
+	coefficients []*int16
+	samples      []byte // the lowest bytes of the magnitudes of the coefficients used
+}
+
+func newJPEGCarrier(img *dct.Image) *jpegCarrier {
+	c := &jpegCarrier{img: img}
+	for i := range img.Components {
+		blocks := img.Components[i].Blocks
+		for j := range blocks {
+			for k := 1; k < len(blocks[j]); k++ {
+				if magnitude := abs16(blocks[j][k]); magnitude >= 1<<maxJPEGDepth {
+					c.coefficients = append(c.coefficients, &blocks[j][k])
+					c.samples = append(c.samples, byte(magnitude))
+				}
+			}
+		}
+	}
+	return c
+}
+
+//decodeJPEGCarrier decodes a JPEG carrier, which is encoded in the DCT coefficients if the result format is JPEG
+//and as RGBA image otherwise.
+func decodeJPEGCarrier(r io.Reader, opts *Options) (Carrier, error) {
+	if opts.Format != "jpeg" {
+		return decodeRGBACarrier(r, opts)
+	}
+	if depth := opts.depth(); depth > maxJPEGDepth {
+		return nil, fmt.Errorf("unsupported depth %d for JPEG results, at most %d is supported", depth, maxJPEGDepth)
+	}
+
+	var configBytes bytes.Buffer // the configuration is read again by dct.Decode
+	config, _, err := image.DecodeConfig(io.TeeReader(r, &configBytes))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding carrier image: %v", err)
+	}
+	if err := checkImageSize(config, opts); err != nil {
+		return nil, err
+	}
+	img, err := dct.Decode(io.MultiReader(&configBytes, r))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding carrier image: %w", err)
+	}
+	return newJPEGCarrier(img), nil
+}
+
+func jpegCarrierSamples(r io.Reader, opts *Options) (int, error) {
+	if opts.Format != "jpeg" {
+		return rgbaCarrierSamples(r, opts)
+	}
+	c, err := decodeJPEGCarrier(r, opts)
+	if err != nil {
+		return 0, err
+	}
+	return c.Len(), nil
+}
+
+func (c *jpegCarrier) Buffer() []byte {
+	return c.samples
+}
+
+func (c *jpegCarrier) Len() int {
+	return len(c.samples)
+}
+
+func (c *jpegCarrier) Offset(i int) int {
+	return i
+}
+
+//Encode writes the image with the changed coefficients as a JPEG image.
+func (c *jpegCarrier) Encode(w io.Writer) error {
+	for i, coefficient := range c.coefficients {
+		magnitude := abs16(*coefficient)&^0xff | int16(c.samples[i])
+		if *coefficient < 0 {
+			magnitude = -magnitude
+		}
+		*coefficient = magnitude
+	}
+	return c.img.Encode(w)
+}
+
+func abs16(v int16) int16 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,120 @@
+package steg_test
+
+import (
+	"bytes"
+	"context"
+	"github.com/DimitarPetrov/stegify/steg"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+//newJPEG returns a baseline JPEG image of pseudo-random colors, rich in large DCT coefficients.
+func newJPEG(t *testing.T) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 256, 192))
+	for y := 0; y < 192; y++ {
+		for x := 0; x < 256; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x*y + y), G: uint8(x*31 ^ y*17), B: uint8(x + y*y), A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatalf("Error encoding JPEG image: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestEncodeWithJPEGResult(t *testing.T) {
+	carrier := newJPEG(t)
+	data := bytes.Repeat([]byte("hidden in coefficients "), 50)
+	var tests = []struct {
+		name string
+		opts *steg.Options
+	}{
+		{"Default depth", &steg.Options{Format: "jpeg"}},
+		{"Depth 1", &steg.Options{Format: "jpeg", Depth: 1}},
+		{"Scattered with key", &steg.Options{Format: "jpeg", Key: []byte("key"), Password: []byte("password")}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var result bytes.Buffer
+			if err := steg.EncodeWithOptions(bytes.NewReader(carrier), bytes.NewReader(data), &result, test.opts); err != nil {
+				t.Fatalf("Error encoding data: %v", err)
+			}
+			if _, format, err := image.DecodeConfig(bytes.NewReader(result.Bytes())); err != nil || format != "jpeg" {
+				t.Fatalf("Expected JPEG result but got %q: %v", format, err)
+			}
+			if _, err := jpeg.Decode(bytes.NewReader(result.Bytes())); err != nil {
+				t.Fatalf("Error decoding result image: %v", err)
+			}
+			scan := bytes.Index(carrier, []byte{0xff, 0xda}) // the tables precede the scan
+			if !bytes.Equal(result.Bytes()[:scan], carrier[:scan]) {
+				t.Fatalf("Expected the tables of the carrier to be kept")
+			}
+
+			var decoded bytes.Buffer
+			if err := steg.DecodeWithOptions(&result, &decoded, test.opts); err != nil {
+				t.Fatalf("Error decoding data: %v", err)
+			}
+			if !bytes.Equal(decoded.Bytes(), data) {
+				t.Errorf("Decoded data does not match the original")
+			}
+		})
+	}
+}
+
+func TestCapacityOfJPEGResult(t *testing.T) {
+	carrier := newJPEG(t)
+	opts := &steg.Options{Format: "jpeg"}
+	capacity, err := steg.Capacity(bytes.NewReader(carrier), opts)
+	if err != nil {
+		t.Fatalf("Error calculating capacity: %v", err)
+	}
+	pngCapacity, err := steg.Capacity(bytes.NewReader(carrier), nil)
+	if err != nil {
+		t.Fatalf("Error calculating capacity: %v", err)
+	}
+	if capacity <= 0 || capacity >= pngCapacity {
+		t.Fatalf("Expected capacity between 0 and %d but got %d", pngCapacity, capacity)
+	}
+
+	encoder := steg.NewEncoder(steg.WithFormat("jpeg"))
+	data := make([]byte, capacity)
+	var result bytes.Buffer
+	if err := encoder.Encode(context.Background(), bytes.NewReader(carrier), bytes.NewReader(data), &result); err != nil {
+		t.Fatalf("Error encoding data of the capacity: %v", err)
+	}
+	if err := encoder.Encode(context.Background(), bytes.NewReader(carrier), bytes.NewReader(append(data, 0)), &result); err == nil {
+		t.Fatalf("Expected error encoding data exceeding the capacity")
+	}
+}
+
+func TestEncodeShouldReturnErrorWhenJPEGResultIsUnsupported(t *testing.T) {
+	var tests = []struct {
+		name    string
+		carrier []byte
+		opts    *steg.Options
+	}{
+		{"Depth 3", newJPEG(t), &steg.Options{Format: "jpeg", Depth: 3}},
+		{"Progressive carrier", progressive(newJPEG(t)), &steg.Options{Format: "jpeg"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var result bytes.Buffer
+			err := steg.EncodeWithOptions(bytes.NewReader(test.carrier), bytes.NewReader([]byte("data")), &result, test.opts)
+			if err == nil {
+				t.Fatal("Expected error")
+			}
+			t.Log(err)
+		})
+	}
+}
+
+//progressive marks the baseline JPEG image as progressive.
+func progressive(img []byte) []byte {
+	img[bytes.Index(img, []byte{0xff, 0xc0})+1] = 0xc2
+	return img
+}
@@ -0,0 +1,223 @@
+package steg
+
+import (
+	"image/png"
+	"runtime"
+)
+
+const defaultDepth = 2
+
+//Options holds optional settings of the encoding and decoding functions.
+//A nil *Options is equivalent to a pointer to the zero value.
+type Options struct {
+	//Legacy makes the decoding functions read carriers encoded by stegify versions
+	//prior to the introduction of the payload header.
+	Legacy bool
+
+	//Password enables encryption of the data when encoding and is required for decoding such data.
+	//The data is sealed with AES-256-GCM using key derived from the password with PBKDF2-HMAC-SHA256.
+	Password []byte
+
+	//Key enables scattering of the encoded data across the whole carrier in pseudo-random order derived from it,
+	//instead of encoding it sequentially from the top-left corner. The same key is required for decoding.
+	Key []byte
+
+	//Depth is the number of least significant bits of every color channel used for encoding the data, from 1 to 4.
+	//Lower depth makes the changes to the carrier harder to detect, while higher depth allows encoding of more data.
+	//Zero means the default depth of 2. When decoding, the depth is detected automatically.
+	Depth int
+
+	//Parity makes the multi carrier encoding functions add given number of carriers worth of Reed-Solomon parity data,
+	//so that any len(carriers) - Parity of the result carriers are enough for decoding. The data is then split in equal pieces,
+	//so the capacity of every carrier is limited to the capacity of the smallest one. The last Parity carriers hold the parity data.
+	//When decoding, the parity is detected automatically.
+	Parity int
+
+	//Threshold makes the multi carrier encoding functions split the data with Shamir's secret sharing,
+	//so that any Threshold of the result carriers are enough for decoding, while fewer reveal nothing about the data.
+	//Every carrier holds a share as large as the whole data, so the capacity is limited to the capacity of the smallest carrier.
+	//It should be between 2 and the number of carriers and could not be combined with Parity. When decoding, the threshold is detected automatically.
+	Threshold int
+
+	//FileInfo is recorded alongside the data when encoding, so the original file could be restored when decoding.
+	//The functions encoding a data file by its name record the information about it if FileInfo is nil.
+	//The record takes a few dozen bytes of the capacity of the carriers, depending on the lengths of the name and the content type.
+	FileInfo *FileInfo
+
+	//Compression is the algorithm compressing the data before encoding it, so more data fits in the carriers.
+	//When decoding, the compression is detected automatically.
+	Compression Compression
+
+	//Jobs is the maximum number of carriers processed concurrently by the multi carrier functions.
+	//Zero means as many as the number of CPUs usable by the program. The results do not depend on it.
+	Jobs int
+
+	//Progress is called with the progress of encoding or decoding after every block of data is processed.
+	//It is never called concurrently, but it could be called from a different goroutine, so it should return quickly.
+	Progress func(Progress)
+
+	//Channels is the set of color channels of the carrier pixels in which the data is encoded. Zero means all of them.
+	//It is not recorded in the carriers, as the header is encoded in the selected channels too, so the decoder must use
+	//the same channels. Decoding with different ones fails, most likely with ErrNoPayload.
+	Channels Channels
+
+	//Format is the image format of the results of encoding image carriers. Empty means PNG for PNG and JPEG carriers
+	//and the format of the carrier for paletted PNG and GIF carriers. The supported formats are "png", "gif" for paletted carriers
+	//and "jpeg" for JPEG carriers, whose data is then encoded in the DCT coefficients, so the result is a JPEG image too.
+	//Such results support depth of at most 2 and hold much less data. The results are always decoded in their own format.
+	//Carriers of other registered formats are encoded in their own format.
+	Format string
+
+	//PNGCompression is the compression level of the results of encoding encoded as PNG images.
+	//It affects only the size of the results and the time spent encoding them, not the data in them.
+	PNGCompression png.CompressionLevel
+
+	//MaxPixels limits the number of pixels of image carriers when decoding, so decoding hostile images could not exhaust the memory.
+	//Zero means the default of 2^28 pixels and negative means no limit. The carriers are not limited when encoding,
+	//so results larger than the limit are decoded only with a higher one.
+	MaxPixels int
+}
+
+//Option configures an Encoder or a Decoder by setting some of its Options.
+type Option func(*Options)
+
+//WithOptions sets all options to the given ones, a nil *Options resets them to the defaults.
+//Options given after it override the respective settings.
+func WithOptions(opts *Options) Option {
+	return func(o *Options) {
+		*o = *opts.orDefault()
+	}
+}
+
+//WithLegacy makes the Decoder read carriers encoded by stegify versions prior to the introduction of the payload header, see Options.Legacy.
+func WithLegacy() Option {
+	return func(o *Options) {
+		o.Legacy = true
+	}
+}
+
+//WithPassword sets the password for encryption of the data, see Options.Password.
+func WithPassword(password []byte) Option {
+	return func(o *Options) {
+		o.Password = append([]byte(nil), password...)
+	}
+}
+
+//WithKey sets the key for scattering of the data across the carriers, see Options.Key.
+func WithKey(key []byte) Option {
+	return func(o *Options) {
+		o.Key = append([]byte(nil), key...)
+	}
+}
+
+//WithDepth sets the number of least significant bits of every color channel used for encoding the data, see Options.Depth.
+func WithDepth(depth int) Option {
+	return func(o *Options) {
+		o.Depth = depth
+	}
+}
+
+//WithParity sets the number of carriers holding parity data, see Options.Parity.
+func WithParity(parity int) Option {
+	return func(o *Options) {
+		o.Parity = parity
+	}
+}
+
+//WithThreshold sets the number of secret shares required for decoding, see Options.Threshold.
+func WithThreshold(threshold int) Option {
+	return func(o *Options) {
+		o.Threshold = threshold
+	}
+}
+
+//WithCompression sets the algorithm compressing the data before encoding it, see Options.Compression.
+func WithCompression(c Compression) Option {
+	return func(o *Options) {
+		o.Compression = c
+	}
+}
+
+//WithJobs sets the maximum number of carriers processed concurrently, see Options.Jobs.
+func WithJobs(jobs int) Option {
+	return func(o *Options) {
+		o.Jobs = jobs
+	}
+}
+
+//WithProgress sets the callback receiving the progress of encoding or decoding, see Options.Progress.
+//It is called concurrently by concurrent calls of the same Encoder or Decoder.
+func WithProgress(progress func(Progress)) Option {
+	return func(o *Options) {
+		o.Progress = progress
+	}
+}
+
+//WithChannels sets the color channels in which the data is encoded, see Options.Channels.
+//The Decoder must be given the same channels as the Encoder.
+func WithChannels(channels Channels) Option {
+	return func(o *Options) {
+		o.Channels = channels
+	}
+}
+
+//WithFormat sets the image format of the results of encoding, see Options.Format.
+func WithFormat(format string) Option {
+	return func(o *Options) {
+		o.Format = format
+	}
+}
+
+//WithPNGCompression sets the compression level of the results of encoding encoded as PNG images, see Options.PNGCompression.
+func WithPNGCompression(level png.CompressionLevel) Option {
+	return func(o *Options) {
+		o.PNGCompression = level
+	}
+}
+
+//WithMaxPixels sets the maximum number of pixels of image carriers when decoding, see Options.MaxPixels.
+func WithMaxPixels(maxPixels int) Option {
+	return func(o *Options) {
+		o.MaxPixels = maxPixels
+	}
+}
+
+//newOptions returns options configured by the given ones.
+func newOptions(options []Option) Options {
+	var opts Options
+	for _, option := range options {
+		option(&opts)
+	}
+	return opts
+}
+
+func (o *Options) orDefault() *Options {
+	if o == nil {
+		return &Options{}
+	}
+	return o
+}
+
+func (o *Options) depth() int {
+	if o.Depth == 0 {
+		return defaultDepth
+	}
+	return o.Depth
+}
+
+func (o *Options) maxPixels() int {
+	switch {
+	case o.MaxPixels == 0:
+		return defaultMaxPixels
+	case o.MaxPixels < 0:
+		return maxInt
+	}
+	return o.MaxPixels
+}
+
+func (o *Options) jobs() int {
+	if o.Jobs <= 0 {
+		return runtime.GOMAXPROCS(0)
+	}
+	return o.Jobs
+}
@@ -0,0 +1,181 @@
+package steg
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io"
+	"sort"
+)
+
+//paletteGroup is the number of consecutive colors of the sorted palette among which a color of a pixel could change,
+//as up to four of the least significant bits of its rank are used.
+const paletteGroup = 1 << 4
+
+func init() {
+	RegisterCarrierFormat(CarrierFormat{Name: "gif", Magic: "GIF8?a", Decode: decodeGIFCarrier, Samples: palettedCarrierSamples(decodeGIFCarrier)})
+}
+
+//palettedCarrier is a paletted image carrier, which is encoded in the indices of the colors of its pixels,
+//so it is written back as a paletted image with the same palette. The opaque colors of the palette are sorted by luminance,
+//so the data could be encoded in the least significant bits of the rank of the color of every pixel, changing it to a similar color.
+//The pixels are ordered frame by frame for animated images and row by row within a frame. Only the pixels of opaque colors
+//with ranks in complete groups of paletteGroup colors are used, so the pixels used do not depend on the encoded data
+//and their colors never change to ones outside of the palette.
+type palettedCarrier struct {
+	frames []palettedFrame
+	ranks  []byte // ranks of the colors of the pixels used of all frames
+
+	format      string // format of the carrier image
+	result      string // format of the result, see Options.Format
+	gif         *gif.GIF
+	compression png.CompressionLevel
+}
+
+//palettedFrame is a frame of a paletted carrier, which has a palette of its own.
+type palettedFrame struct {
+	img    *image.Paletted
+	pixels []int32 // offsets in the Pix buffer of the pixels used
+	colors []uint8 // indices of the colors in the palette by their ranks
+}
+
+func newPalettedCarrier(frames []*image.Paletted, format string, opts *Options) *palettedCarrier {
+	c := &palettedCarrier{
+		format:      format,
+		result:      opts.Format,
+		compression: opts.PNGCompression,
+	}
+	for _, img := range frames {
+		c.frames = append(c.frames, c.addFrame(img))
+	}
+	return c
+}
+
+//addFrame adds the ranks of the colors of the pixels of img used to the carrier and returns it as a frame.
+func (c *palettedCarrier) addFrame(img *image.Paletted) palettedFrame {
+	f := palettedFrame{img: img, colors: sortPalette(img.Palette)}
+
+	ranks := make([]int, len(img.Palette))
+	for i := range ranks {
+		ranks[i] = -1 // not used
+	}
+	for rank, index := range f.colors[:len(f.colors)/paletteGroup*paletteGroup] {
+		ranks[index] = rank
+	}
+
+	b := img.Bounds()
+	f.pixels = make([]int32, 0, b.Dx()*b.Dy())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			offset := img.PixOffset(x, y)
+			if index := int(img.Pix[offset]); index < len(ranks) && ranks[index] >= 0 {
+				c.ranks = append(c.ranks, byte(ranks[index]))
+				f.pixels = append(f.pixels, int32(offset))
+			}
+		}
+	}
+	return f
+}
+
+//sortPalette returns the indices of the opaque colors of palette sorted by their luminance.
+func sortPalette(palette color.Palette) []uint8 {
+	var indices []uint8
+	luminance := make([]uint32, len(palette))
+	for i, c := range palette {
+		r, g, b, a := c.RGBA()
+		if a != 0xffff || i > 0xff {
+			continue // changing the color of a transparent pixel would be visible
+		}
+		luminance[i] = 299*r + 587*g + 114*b
+		indices = append(indices, uint8(i))
+	}
+	sort.SliceStable(indices, func(i, j int) bool {
+		return luminance[indices[i]] < luminance[indices[j]]
+	})
+	return indices
+}
+
+func decodeGIFCarrier(r io.Reader, opts *Options) (Carrier, error) {
+	var configBytes bytes.Buffer // the configuration is read again by gif.DecodeAll
+	config, err := gif.DecodeConfig(io.TeeReader(r, &configBytes))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding carrier image: %v", err)
+	}
+	if err := checkImageSize(config, opts); err != nil {
+		return nil, err
+	}
+
+	g, err := gif.DecodeAll(io.MultiReader(&configBytes, r))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding carrier image: %v", err)
+	}
+	pixels := 0
+	for _, frame := range g.Image {
+		if pixels += frame.Bounds().Dx() * frame.Bounds().Dy(); pixels > opts.maxPixels() {
+			return nil, fmt.Errorf("unsupported carrier image with %d frames of size %dx%d", len(g.Image), config.Width, config.Height)
+		}
+	}
+	c := newPalettedCarrier(g.Image, "gif", opts)
+	c.gif = g
+	return c, nil
+}
+
+//palettedCarrierSamples returns function counting the samples of paletted carriers decoded by decode,
+//as the colors of all pixels should be known.
+func palettedCarrierSamples(decode func(io.Reader, *Options) (Carrier, error)) func(io.Reader, *Options) (int, error) {
+	return func(r io.Reader, opts *Options) (int, error) {
+		c, err := decode(r, opts)
+		if err != nil {
+			return 0, err
+		}
+		return c.Len(), nil
+	}
+}
+
+func (c *palettedCarrier) Buffer() []byte {
+	return c.ranks
+}
+
+func (c *palettedCarrier) Len() int {
+	return len(c.ranks)
+}
+
+func (c *palettedCarrier) Offset(i int) int {
+	return i
+}
+
+//Encode writes the image with the colors of the pixels changed according to their ranks in the result format,
+//which is the format of the carrier by default. The palettes, the frames of animated GIF carriers along with their delays
+//and disposal methods and the loop count are preserved. Only the first frame is written in other formats,
+//so animated carriers could not be encoded in them.
+func (c *palettedCarrier) Encode(w io.Writer) error {
+	ranks := c.ranks
+	for _, f := range c.frames {
+		for i, offset := range f.pixels {
+			f.img.Pix[offset] = f.colors[ranks[i]]
+		}
+		ranks = ranks[len(f.pixels):]
+	}
+
+	format := c.result
+	if format == "" {
+		format = c.format
+	}
+	if len(c.frames) > 1 && format != "gif" {
+		return fmt.Errorf("unsupported result format %s for animated carrier", format)
+	}
+	switch format {
+	case "png":
+		return (&png.Encoder{CompressionLevel: c.compression}).Encode(w, c.frames[0].img)
+	case "gif":
+		if c.gif == nil {
+			return gif.Encode(w, c.frames[0].img, nil)
+		}
+		return gif.EncodeAll(w, c.gif)
+	default:
+		return fmt.Errorf("unsupported result format %s", format)
+	}
+}
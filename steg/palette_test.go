@@ -0,0 +1,195 @@
+package steg_test
+
+import (
+	"bytes"
+	"github.com/DimitarPetrov/stegify/steg"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+)
+
+//newPalettedImage returns a paletted image with given number of pseudo-random colors in its palette,
+//the first of them transparent, and pseudo-random pixels.
+func newPalettedImage(colors, width, height int) *image.Paletted {
+	r := rand.New(rand.NewSource(1))
+	palette := color.Palette{color.RGBA{}}
+	for len(palette) < colors {
+		palette = append(palette, color.RGBA{R: uint8(r.Intn(256)), G: uint8(r.Intn(256)), B: uint8(r.Intn(256)), A: 0xff})
+	}
+	img := image.NewPaletted(image.Rect(0, 0, width, height), palette)
+	for i := range img.Pix {
+		img.Pix[i] = uint8(r.Intn(colors))
+	}
+	return img
+}
+
+func TestEncodeWithPalettedCarrier(t *testing.T) {
+	img := newPalettedImage(256, 200, 150)
+	var pngCarrier, gifCarrier bytes.Buffer
+	if err := png.Encode(&pngCarrier, img); err != nil {
+		t.Fatalf("Error encoding carrier: %v", err)
+	}
+	if err := gif.Encode(&gifCarrier, img, nil); err != nil {
+		t.Fatalf("Error encoding carrier: %v", err)
+	}
+	data := bytes.Repeat([]byte("hidden in a palette "), 100)
+
+	var tests = []struct {
+		name    string
+		carrier []byte
+		format  string
+		opts    *steg.Options
+	}{
+		{"PNG", pngCarrier.Bytes(), "png", nil},
+		{"GIF", gifCarrier.Bytes(), "gif", nil},
+		{"GIF with depth 1 and key", gifCarrier.Bytes(), "gif", &steg.Options{Depth: 1, Key: []byte("key")}},
+		{"GIF to PNG", gifCarrier.Bytes(), "png", &steg.Options{Format: "png"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var result bytes.Buffer
+			if err := steg.EncodeWithOptions(bytes.NewReader(test.carrier), bytes.NewReader(data), &result, test.opts); err != nil {
+				t.Fatalf("Error encoding data: %v", err)
+			}
+
+			resultImg, format, err := image.Decode(bytes.NewReader(result.Bytes()))
+			if err != nil {
+				t.Fatalf("Error decoding result image: %v", err)
+			}
+			if format != test.format {
+				t.Errorf("Expected result in %s format but got %s", test.format, format)
+			}
+			paletted, ok := resultImg.(*image.Paletted)
+			if !ok {
+				t.Fatalf("Expected paletted result but got %T", resultImg)
+			}
+			if len(paletted.Palette) != len(img.Palette) {
+				t.Fatalf("Expected palette of %d colors but got %d", len(img.Palette), len(paletted.Palette))
+			}
+			changed := 0
+			for i, index := range paletted.Pix {
+				if (index == 0) != (img.Pix[i] == 0) {
+					t.Fatalf("Expected transparency of pixel %d not to change", i)
+				}
+				if index != img.Pix[i] {
+					changed++
+				}
+			}
+			if changed == 0 {
+				t.Errorf("Expected some pixels to change")
+			}
+
+			var decoded bytes.Buffer
+			if err := steg.DecodeWithOptions(&result, &decoded, test.opts); err != nil {
+				t.Fatalf("Error decoding data: %v", err)
+			}
+			if !bytes.Equal(decoded.Bytes(), data) {
+				t.Errorf("Decoded data does not match the original")
+			}
+		})
+	}
+}
+
+func TestCapacityOfPalettedCarrierShouldSkipIncompleteColorGroups(t *testing.T) {
+	var tests = []struct {
+		name     string
+		colors   int
+		expected bool
+	}{
+		{"Full palette", 256, true},
+		{"Palette of 17 colors", 17, true},
+		{"Palette of 16 colors", 16, false}, // a transparent color and 15 opaque ones
+		{"Palette of 4 colors", 4, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var carrier bytes.Buffer
+			if err := png.Encode(&carrier, newPalettedImage(test.colors, 100, 100)); err != nil {
+				t.Fatalf("Error encoding carrier: %v", err)
+			}
+			capacity, err := steg.Capacity(&carrier, nil)
+			if err != nil {
+				t.Fatalf("Error calculating capacity: %v", err)
+			}
+			if (capacity > 0) != test.expected {
+				t.Errorf("Unexpected capacity %d of carrier with %d colors", capacity, test.colors)
+			}
+		})
+	}
+}
+
+func TestEncodeWithAnimatedGIFCarrier(t *testing.T) {
+	carrier, err := ioutil.ReadFile("../examples/video.gif")
+	if err != nil {
+		t.Fatalf("Error reading carrier file: %v", err)
+	}
+	original, err := gif.DecodeAll(bytes.NewReader(carrier))
+	if err != nil {
+		t.Fatalf("Error decoding carrier: %v", err)
+	}
+	frame := original.Image[0].Bounds()
+	data := make([]byte, frame.Dx()*frame.Dy()/2) // more than a single frame could hold
+	rand.New(rand.NewSource(1)).Read(data)
+
+	var result bytes.Buffer
+	if err := steg.EncodeWithOptions(bytes.NewReader(carrier), bytes.NewReader(data), &result, &steg.Options{Depth: 1}); err != nil {
+		t.Fatalf("Error encoding data: %v", err)
+	}
+
+	encoded, err := gif.DecodeAll(bytes.NewReader(result.Bytes()))
+	if err != nil {
+		t.Fatalf("Error decoding result image: %v", err)
+	}
+	if len(encoded.Image) != len(original.Image) {
+		t.Fatalf("Expected %d frames but got %d", len(original.Image), len(encoded.Image))
+	}
+	if encoded.LoopCount != original.LoopCount {
+		t.Errorf("Expected loop count %d but got %d", original.LoopCount, encoded.LoopCount)
+	}
+	for i := range original.Image {
+		if encoded.Delay[i] != original.Delay[i] || encoded.Disposal[i] != original.Disposal[i] {
+			t.Fatalf("Expected delay %d and disposal %d of frame %d but got %d and %d",
+				original.Delay[i], original.Disposal[i], i, encoded.Delay[i], encoded.Disposal[i])
+		}
+		if encoded.Image[i].Bounds() != original.Image[i].Bounds() {
+			t.Fatalf("Expected bounds %v of frame %d but got %v", original.Image[i].Bounds(), i, encoded.Image[i].Bounds())
+		}
+	}
+	if bytes.Equal(encoded.Image[1].Pix, original.Image[1].Pix) {
+		t.Errorf("Expected the data to spread to the second frame")
+	}
+
+	var decoded bytes.Buffer
+	if err := steg.Decode(&result, &decoded); err != nil {
+		t.Fatalf("Error decoding data: %v", err)
+	}
+	if !bytes.Equal(decoded.Bytes(), data) {
+		t.Errorf("Decoded data does not match the original")
+	}
+}
+
+func TestCapacityOfAnimatedGIFCarrierShouldBeSummedOverFrames(t *testing.T) {
+	frames := []*image.Paletted{newPalettedImage(256, 50, 40), newPalettedImage(256, 50, 40), newPalettedImage(256, 50, 40)}
+	capacities := make([]int, 0, len(frames))
+	for i := range frames {
+		var carrier bytes.Buffer
+		if err := gif.EncodeAll(&carrier, &gif.GIF{Image: frames[:i+1], Delay: make([]int, i+1)}); err != nil {
+			t.Fatalf("Error encoding carrier: %v", err)
+		}
+		capacity, err := steg.Capacity(&carrier, nil)
+		if err != nil {
+			t.Fatalf("Error calculating capacity: %v", err)
+		}
+		capacities = append(capacities, capacity)
+	}
+
+	if capacities[1] <= capacities[0] || capacities[2]-capacities[1] != capacities[1]-capacities[0] {
+		t.Errorf("Expected capacity growing by the same amount with every frame but got %v", capacities)
+	}
+}
@@ -0,0 +1,59 @@
+package steg
+
+import (
+	"context"
+	"sync"
+)
+
+//Progress describes how far encoding or decoding got, as reported to Options.Progress.
+//The counts cover all carriers of a multi carrier call.
+type Progress struct {
+	Pixels      int   // pixels of the carriers, or samples of carriers other than images, in which data was embedded or from which it was extracted so far
+	TotalPixels int   // total pixels, or samples of carriers other than images, of the carriers read so far
+	Bytes       int64 // bytes of data embedded or extracted so far, as encoded in the carriers
+	TotalBytes  int64 // total bytes of data of the carriers read so far, when known
+}
+
+//task holds the context of an encoding or decoding call and tracks its progress across all of its carriers.
+type task struct {
+	ctx      context.Context
+	report   func(Progress)
+	mu       sync.Mutex
+	progress Progress
+}
+
+func newTask(ctx context.Context, opts *Options) *task {
+	return &task{ctx: ctx, report: opts.Progress}
+}
+
+//err returns the error of the context if it is done, so the call should stop.
+func (t *task) err() error {
+	return t.ctx.Err()
+}
+
+//addTotal adds the pixels and the bytes of data of a carrier to the totals.
+func (t *task) addTotal(pixels int, bytes int64) {
+	t.update(func() {
+		t.progress.TotalPixels += pixels
+		t.progress.TotalBytes += bytes
+	})
+}
+
+//add adds the pixels and the bytes of data just processed.
+func (t *task) add(pixels int, bytes int64) {
+	t.update(func() {
+		t.progress.Pixels += pixels
+		t.progress.Bytes += bytes
+	})
+}
+
+//update applies f to the progress and reports it. The reports are serialized, so they are never out of order.
+func (t *task) update(f func()) {
+	if t.report == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f()
+	t.report(t.progress)
+}
@@ -0,0 +1,84 @@
+package steg
+
+import "fmt"
+
+const maxShards = 256 // limited by the number of distinct elements of GF(2^8)
+
+//Systematic Reed-Solomon erasure code: the data is split in dataShards shards, which are kept as they are,
+//and parityShards parity shards are computed, so that any dataShards of all shards are enough to reconstruct the data.
+//The encoding matrix is the identity matrix on top of a Cauchy matrix, every square submatrix of which is invertible.
+
+//encodingRow returns the row of the encoding matrix producing the shard with given index.
+func encodingRow(index, dataShards int) []byte {
+	row := make([]byte, dataShards)
+	if index < dataShards {
+		row[index] = 1
+		return row
+	}
+	for j := range row {
+		row[j] = gfInv(byte(index) ^ byte(j)) // 1 / (x_i + y_j) with x_i = index >= dataShards > y_j = j
+	}
+	return row
+}
+
+//encodeShards splits data in dataShards equally sized shards, padded with zeros, and appends parityShards parity shards.
+func encodeShards(data []byte, dataShards, parityShards int) [][]byte {
+	shardSize := (len(data) + dataShards - 1) / dataShards
+	padded := make([]byte, shardSize*dataShards)
+	copy(padded, data)
+
+	shards := make([][]byte, dataShards+parityShards)
+	for i := 0; i < dataShards; i++ {
+		shards[i] = padded[i*shardSize : (i+1)*shardSize]
+	}
+	for i := dataShards; i < len(shards); i++ {
+		shards[i] = make([]byte, shardSize)
+		for j, c := range encodingRow(i, dataShards) {
+			gfMulSlice(c, shards[j], shards[i])
+		}
+	}
+	return shards
+}
+
+//reconstructData returns the data of given length from shards produced by encodeShards, where missing shards are nil.
+//At least dataShards shards are required.
+func reconstructData(shards [][]byte, dataShards int, length uint64) ([]byte, error) {
+	rows := make([][]byte, 0, dataShards)
+	present := make([][]byte, 0, dataShards)
+	for i, shard := range shards {
+		if shard != nil && len(present) < dataShards {
+			rows = append(rows, encodingRow(i, dataShards))
+			present = append(present, shard)
+		}
+	}
+	if len(present) < dataShards {
+		return nil, fmt.Errorf("%d shards required for reconstruction, %d given", dataShards, len(present))
+	}
+
+	shardSize := len(present[0])
+	for _, shard := range present {
+		if len(shard) != shardSize {
+			return nil, fmt.Errorf("shards of different sizes given")
+		}
+	}
+	if length > uint64(shardSize*dataShards) {
+		return nil, fmt.Errorf("shards too short for data of %d bytes", length)
+	}
+
+	decoding, err := gfInvertMatrix(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, shardSize*dataShards)
+	for i := 0; i < dataShards; i++ {
+		if shards[i] != nil {
+			copy(data[i*shardSize:], shards[i])
+			continue
+		}
+		for j, c := range decoding[i] {
+			gfMulSlice(c, present[j], data[i*shardSize:(i+1)*shardSize])
+		}
+	}
+	return data[:length], nil
+}
@@ -0,0 +1,210 @@
+package steg
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/jpeg" //register jpeg image format
+	"image/png"
+	"io"
+)
+
+const (
+	defaultMaxPixels = 1 << 28 // limits the size of image carriers when decoding, see Options.MaxPixels
+	maxInt           = int(^uint(0) >> 1)
+)
+
+//imageCarrierFormat decodes carriers in any format registered with the image package, as RGBA images.
+//It is used for the carriers not matching any of the registered carrier formats.
+var imageCarrierFormat = CarrierFormat{
+	Name:    "image",
+	Decode:  decodeRGBACarrier,
+	Samples: rgbaCarrierSamples,
+}
+
+func init() {
+	RegisterCarrierFormat(CarrierFormat{Name: "png", Magic: "\x89PNG\r\n\x1a\n", Decode: decodePNGCarrier, Samples: pngCarrierSamples})
+	RegisterCarrierFormat(CarrierFormat{Name: "jpeg", Magic: "\xff\xd8", Decode: decodeJPEGCarrier, Samples: jpegCarrierSamples})
+}
+
+//rgbaCarrier is an image carrier, in which the data is encoded in the selected color channels of its pixels.
+//The channels are ordered pixel by pixel column by column and R, G, B within a pixel, skipping the channels not selected.
+type rgbaCarrier struct {
+	img      *image.RGBA
+	dy       int
+	channels []int // offsets of the selected color channels within a pixel
+	count    int
+
+	format      string // format of the carrier image
+	result      string // format of the result, see Options.Format
+	compression png.CompressionLevel
+}
+
+func newRGBACarrier(img *image.RGBA, format string, opts *Options) (*rgbaCarrier, error) {
+	offsets, err := opts.Channels.offsets()
+	if err != nil {
+		return nil, err
+	}
+	return &rgbaCarrier{
+		img:         img,
+		dy:          img.Bounds().Dy(),
+		channels:    offsets,
+		count:       img.Bounds().Dx() * img.Bounds().Dy() * len(offsets),
+		format:      format,
+		result:      opts.Format,
+		compression: opts.PNGCompression,
+	}, nil
+}
+
+func decodeRGBACarrier(r io.Reader, opts *Options) (Carrier, error) {
+	img, format, err := decodeImage(r, opts)
+	if err != nil {
+		return nil, err
+	}
+	return newRGBACarrier(toRGBA(img), format, opts)
+}
+
+//decodePNGCarrier decodes a PNG carrier, which is a paletted carrier if the image is paletted and an RGBA carrier otherwise.
+func decodePNGCarrier(r io.Reader, opts *Options) (Carrier, error) {
+	img, format, err := decodeImage(r, opts)
+	if err != nil {
+		return nil, err
+	}
+	if paletted, ok := img.(*image.Paletted); ok {
+		return newPalettedCarrier([]*image.Paletted{paletted}, format, opts), nil
+	}
+	return newRGBACarrier(toRGBA(img), format, opts)
+}
+
+func pngCarrierSamples(r io.Reader, opts *Options) (int, error) {
+	var configBytes bytes.Buffer // the configuration is read again if the image is paletted
+	config, _, err := image.DecodeConfig(io.TeeReader(r, &configBytes))
+	if err != nil {
+		return 0, fmt.Errorf("error decoding carrier image: %v", err)
+	}
+	if _, ok := config.ColorModel.(color.Palette); ok {
+		return palettedCarrierSamples(decodePNGCarrier)(io.MultiReader(&configBytes, r), opts)
+	}
+	return rgbaSamples(config, opts)
+}
+
+func rgbaCarrierSamples(r io.Reader, opts *Options) (int, error) {
+	config, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return 0, fmt.Errorf("error decoding carrier image: %v", err)
+	}
+	return rgbaSamples(config, opts)
+}
+
+func rgbaSamples(config image.Config, opts *Options) (int, error) {
+	channels, err := opts.Channels.offsets()
+	if err != nil {
+		return 0, err
+	}
+	return config.Width * config.Height * len(channels), nil
+}
+
+func (c *rgbaCarrier) Buffer() []byte {
+	return c.img.Pix
+}
+
+func (c *rgbaCarrier) Len() int {
+	return c.count
+}
+
+func (c *rgbaCarrier) Offset(i int) int {
+	pixel, channel := i/len(c.channels), i%len(c.channels)
+	x, y := pixel/c.dy, pixel%c.dy
+	return c.img.PixOffset(c.img.Rect.Min.X+x, c.img.Rect.Min.Y+y) + c.channels[channel]
+}
+
+//Encode encodes the image in the result format, which is PNG for PNG and JPEG carriers.
+func (c *rgbaCarrier) Encode(w io.Writer) error {
+	switch {
+	case c.result == "png" || c.result == "" && (c.format == "png" || c.format == "jpeg"):
+		return (&png.Encoder{CompressionLevel: c.compression}).Encode(w, c.img)
+	case c.result != "":
+		return fmt.Errorf("unsupported result format %s", c.result)
+	default:
+		return fmt.Errorf("unsupported carrier format")
+	}
+}
+
+func (c *rgbaCarrier) samplesPerPixel() int {
+	return len(c.channels)
+}
+
+func (c *rgbaCarrier) embedBlock(start int, groups []byte, mask byte) {
+	c.walkBlock(start, groups, mask, true)
+}
+
+func (c *rgbaCarrier) extractBlock(start int, groups []byte, mask byte) {
+	c.walkBlock(start, groups, mask, false)
+}
+
+//walkBlock embeds or extracts the groups in the samples from start on. The columns spanned by the block are walked
+//row by row, so the Pix buffer is accessed sequentially rather than a row apart, while the groups keep the order of the samples,
+//which is column by column.
+func (c *rgbaCarrier) walkBlock(start int, groups []byte, mask byte, embed bool) {
+	n := len(groups)
+	if n == 0 {
+		return
+	}
+	pix := c.img.Pix
+	perPixel := len(c.channels)
+	perColumn := c.dy * perPixel
+	firstX, lastX := start/perColumn, (start+n-1)/perColumn
+	for y := 0; y < c.dy; y++ {
+		offset := c.img.PixOffset(c.img.Rect.Min.X+firstX, c.img.Rect.Min.Y+y)
+		j := firstX*perColumn + y*perPixel - start // index of the group of the first sample of the pixel
+		for x := firstX; x <= lastX; x++ {
+			for channel, channelOffset := range c.channels {
+				k, o := j+channel, offset+channelOffset
+				switch {
+				case k < 0 || k >= n: // the sample is outside of the block
+				case embed:
+					pix[o] = pix[o]&^mask | groups[k]
+				default:
+					groups[k] = pix[o] & mask
+				}
+			}
+			offset += 4
+			j += perColumn
+		}
+	}
+}
+
+//decodeImage decodes an image read from r, rejecting images too large to be carriers before decoding them.
+func decodeImage(reader io.Reader, opts *Options) (image.Image, string, error) {
+	var configBytes bytes.Buffer // the configuration is read again by image.Decode
+	config, _, err := image.DecodeConfig(io.TeeReader(reader, &configBytes))
+	if err != nil {
+		return nil, "", fmt.Errorf("error decoding carrier image: %v", err)
+	}
+	if err := checkImageSize(config, opts); err != nil {
+		return nil, "", err
+	}
+
+	img, format, err := image.Decode(io.MultiReader(&configBytes, reader))
+	if err != nil {
+		return nil, format, fmt.Errorf("error decoding carrier image: %v", err)
+	}
+	return img, format, nil
+}
+
+//checkImageSize returns error if the size of the image is not supported for carriers, see Options.MaxPixels.
+func checkImageSize(config image.Config, opts *Options) error {
+	if config.Width <= 0 || config.Height <= 0 || config.Width > opts.maxPixels()/config.Height {
+		return fmt.Errorf("unsupported carrier image size %dx%d", config.Width, config.Height)
+	}
+	return nil
+}
+
+//toRGBA returns a copy of img as RGBA image with bounds starting at the origin.
+func toRGBA(img image.Image) *image.RGBA {
+	RGBAImage := image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.Draw(RGBAImage, RGBAImage.Bounds(), img, img.Bounds().Min, draw.Src)
+	return RGBAImage
+}
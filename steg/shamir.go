@@ -0,0 +1,67 @@
+package steg
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+const maxShares = 255 // limited by the number of distinct non-zero elements of GF(2^8)
+
+//Shamir's secret sharing over GF(2^8): every byte of the secret is the constant term of a random polynomial of degree threshold - 1
+//and the share with index i holds the values of the polynomials at x = i + 1. Any threshold of the shares determine the polynomials,
+//while fewer reveal nothing about the secret.
+
+//splitShares splits secret in given number of shares, any threshold of which are enough to reconstruct it.
+func splitShares(secret []byte, shares, threshold int) ([][]byte, error) {
+	coefficients := make([]byte, len(secret)*(threshold-1))
+	if _, err := rand.Read(coefficients); err != nil {
+		return nil, fmt.Errorf("error generating shares: %v", err)
+	}
+
+	result := make([][]byte, shares)
+	for i := range result {
+		x := byte(i + 1)
+		share := make([]byte, len(secret))
+		for j, s := range secret {
+			poly := coefficients[j*(threshold-1) : (j+1)*(threshold-1)]
+			var y byte
+			for k := len(poly) - 1; k >= 0; k-- { // Horner's method
+				y = gfMul(y, x) ^ poly[k]
+			}
+			share[j] = gfMul(y, x) ^ s
+		}
+		result[i] = share
+	}
+	return result, nil
+}
+
+//combineShares reconstructs the secret from shares produced by splitShares, where missing shares are nil.
+//At least threshold shares are required.
+func combineShares(shares [][]byte, threshold int) ([]byte, error) {
+	xs := make([]byte, 0, threshold)
+	present := make([][]byte, 0, threshold)
+	for i, share := range shares {
+		if share != nil && len(present) < threshold {
+			xs = append(xs, byte(i+1))
+			present = append(present, share)
+		}
+	}
+	if len(present) < threshold {
+		return nil, fmt.Errorf("%d shares required for reconstruction, %d given", threshold, len(present))
+	}
+
+	secret := make([]byte, len(present[0]))
+	for i, share := range present {
+		if len(share) != len(secret) {
+			return nil, fmt.Errorf("shares of different sizes given")
+		}
+		basis := byte(1) // the Lagrange basis polynomial of x_i evaluated at 0
+		for j, x := range xs {
+			if j != i {
+				basis = gfMul(basis, gfMul(x, gfInv(x^xs[i])))
+			}
+		}
+		gfMulSlice(basis, share, secret)
+	}
+	return secret, nil
+}
@@ -0,0 +1,164 @@
+package steg
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+)
+
+const feistelRounds = 4
+
+var scatterSalt = []byte("stegify scatter")
+
+//slots provides access to the samples of a carrier in which the data is encoded, in sequential order.
+//The samples are ordered by their indices in the carrier, unless a key is given,
+//in which case they are scattered pseudo-randomly across the whole carrier.
+type slots struct {
+	carrier  Carrier
+	buf      []byte
+	count    int
+	perPixel int // samples per pixel of image carriers, 1 for other carriers
+	perm     *permutation
+}
+
+//blockCarrier is implemented by carriers, which embed and extract blocks of consecutive samples faster than with the Offset method,
+//e.g. by visiting them in the order of their offsets, so the buffer is accessed sequentially.
+type blockCarrier interface {
+	//embedBlock sets the bits selected by mask of the samples from start on to the respective groups.
+	embedBlock(start int, groups []byte, mask byte)
+
+	//extractBlock sets the groups to the bits selected by mask of the respective samples from start on.
+	extractBlock(start int, groups []byte, mask byte)
+}
+
+//pixelCarrier is implemented by image carriers, so the progress could be reported in pixels.
+type pixelCarrier interface {
+	samplesPerPixel() int
+}
+
+func newSlots(carrier Carrier, key []byte) (*slots, error) {
+	s := &slots{
+		carrier:  carrier,
+		buf:      carrier.Buffer(),
+		count:    carrier.Len(),
+		perPixel: 1,
+	}
+	if p, ok := carrier.(pixelCarrier); ok {
+		s.perPixel = p.samplesPerPixel()
+	}
+	if len(key) != 0 {
+		block, err := aes.NewCipher(deriveKey(key, scatterSalt))
+		if err != nil {
+			return nil, fmt.Errorf("error creating cipher: %v", err)
+		}
+		s.perm = newPermutation(block, s.count)
+	}
+	return s, nil
+}
+
+//at returns the sample with given sequential index.
+func (s *slots) at(i int) *byte {
+	if s.perm != nil {
+		i = s.perm.at(i)
+	}
+	return &s.buf[s.carrier.Offset(i)]
+}
+
+//pixels returns the number of pixels spanned by given number of samples, or the number of samples if the carrier is not an image.
+func (s *slots) pixels(samples int) int {
+	return samples / s.perPixel
+}
+
+//cursor returns a cursor over the samples starting from given sequential index.
+func (s *slots) cursor(start int) *cursor {
+	c := &cursor{s: s, i: start}
+	if s.perm == nil {
+		c.block, _ = s.carrier.(blockCarrier)
+	}
+	return c
+}
+
+//cursor iterates over the samples of slots in sequential order, embedding and extracting blocks of groups of bits.
+type cursor struct {
+	s     *slots
+	i     int          // sequential index of the next sample
+	block blockCarrier // the carrier if it embeds and extracts blocks itself and the samples are not scattered
+}
+
+//remaining returns the number of samples left.
+func (c *cursor) remaining() int {
+	return c.s.count - c.i
+}
+
+//embed sets the bits selected by mask of the next len(groups) samples to the groups and advances the cursor past them.
+//It should not be called with more groups than the remaining samples.
+func (c *cursor) embed(groups []byte, mask byte) {
+	if c.block != nil {
+		c.block.embedBlock(c.i, groups, mask)
+	} else {
+		for j, group := range groups {
+			sample := c.s.at(c.i + j)
+			*sample = *sample&^mask | group
+		}
+	}
+	c.i += len(groups)
+}
+
+//extract sets the groups to the bits selected by mask of the next len(groups) samples and advances the cursor past them.
+//It should not be called with more groups than the remaining samples.
+func (c *cursor) extract(groups []byte, mask byte) {
+	if c.block != nil {
+		c.block.extractBlock(c.i, groups, mask)
+	} else {
+		for j := range groups {
+			groups[j] = *c.s.at(c.i + j) & mask
+		}
+	}
+	c.i += len(groups)
+}
+
+//permutation is a keyed pseudo-random bijection of [0, n) computed on the fly, so no memory proportional to n is needed.
+//It is a balanced Feistel network with AES as round function over the smallest even power of two not less than n,
+//applied repeatedly until the result falls in [0, n) (cycle walking).
+type permutation struct {
+	n        uint64
+	halfBits uint
+	mask     uint64
+	block    cipher.Block
+	in, out  [aes.BlockSize]byte
+}
+
+func newPermutation(block cipher.Block, n int) *permutation {
+	var halfBits uint
+	for uint64(1)<<(2*halfBits) < uint64(n) {
+		halfBits++
+	}
+	return &permutation{
+		n:        uint64(n),
+		halfBits: halfBits,
+		mask:     uint64(1)<<halfBits - 1,
+		block:    block,
+	}
+}
+
+func (p *permutation) at(i int) int {
+	v := uint64(i)
+	for {
+		l, r := v>>p.halfBits, v&p.mask
+		for round := 0; round < feistelRounds; round++ {
+			l, r = r, l^p.round(byte(round), r)
+		}
+		v = l<<p.halfBits | r
+		if v < p.n {
+			return int(v)
+		}
+	}
+}
+
+func (p *permutation) round(round byte, r uint64) uint64 {
+	binary.LittleEndian.PutUint64(p.in[:], r)
+	p.in[8] = round
+	p.block.Encrypt(p.out[:], p.in[:])
+	return binary.LittleEndian.Uint64(p.out[:]) & p.mask
+}
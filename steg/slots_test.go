@@ -0,0 +1,128 @@
+package steg
+
+import (
+	"crypto/aes"
+	"fmt"
+	"image"
+	"testing"
+)
+
+func TestPermutationIsBijection(t *testing.T) {
+	block, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatalf("Error creating cipher: %v", err)
+	}
+
+	for _, n := range []int{1, 2, 3, 17, 64, 1000, 4099} {
+		t.Run(fmt.Sprintf("permutation of %d", n), func(t *testing.T) {
+			p := newPermutation(block, n)
+			seen := make([]bool, n)
+			for i := 0; i < n; i++ {
+				v := p.at(i)
+				if v < 0 || v >= n {
+					t.Fatalf("Expected value in [0, %d) but got %d", n, v)
+				}
+				if seen[v] {
+					t.Fatalf("Value %d returned more than once", v)
+				}
+				seen[v] = true
+			}
+		})
+	}
+}
+
+func TestCursorFollowsSlotsOrder(t *testing.T) {
+	var tests = []struct {
+		name     string
+		img      *image.RGBA
+		key      []byte
+		channels Channels
+		start    int
+	}{
+		{"whole image", image.NewRGBA(image.Rect(0, 0, 7, 5)), nil, AllChannels, 0},
+		{"single row", image.NewRGBA(image.Rect(0, 0, 9, 1)), nil, AllChannels, 0},
+		{"single column", image.NewRGBA(image.Rect(0, 0, 1, 9)), nil, AllChannels, 0},
+		{"start within pixel", image.NewRGBA(image.Rect(0, 0, 7, 5)), nil, AllChannels, 23},
+		{"start at the end", image.NewRGBA(image.Rect(0, 0, 7, 5)), nil, AllChannels, 7 * 5 * 3},
+		{"sub image", image.NewRGBA(image.Rect(0, 0, 10, 10)).SubImage(image.Rect(2, 3, 8, 7)).(*image.RGBA), nil, AllChannels, 4},
+		{"scattered", image.NewRGBA(image.Rect(0, 0, 7, 5)), []byte("key"), AllChannels, 5},
+		{"red and blue channels", image.NewRGBA(image.Rect(0, 0, 7, 5)), nil, Red | Blue, 3},
+		{"green channel", image.NewRGBA(image.Rect(0, 0, 7, 5)), nil, Green, 0},
+		{"scattered blue channel", image.NewRGBA(image.Rect(0, 0, 7, 5)), []byte("key"), Blue, 0},
+	}
+
+	for _, test := range tests {
+		for _, block := range []int{1, 4, 13, 37, test.img.Rect.Dx() * test.img.Rect.Dy() * 3} {
+			t.Run(fmt.Sprintf("%s in blocks of %d", test.name, block), func(t *testing.T) {
+				s := newTestSlots(t, test.img, test.key, test.channels)
+				c := s.cursor(test.start)
+				for i := test.start; i < s.count; i += block {
+					if c.remaining() != s.count-i {
+						t.Fatalf("Expected %d remaining color channels but got %d", s.count-i, c.remaining())
+					}
+					n := block
+					if n > c.remaining() {
+						n = c.remaining()
+					}
+					groups := make([]byte, n)
+					for j := range groups {
+						groups[j] = byte(i + j)
+					}
+					c.embed(groups, 0xff)
+					for j := range groups {
+						if actual := *s.at(i + j); actual != byte(i+j) {
+							t.Fatalf("Cursor embedded %d in slot %d instead of %d", actual, i+j, byte(i+j))
+						}
+					}
+				}
+
+				c = s.cursor(test.start)
+				for i := test.start; i < s.count; i += block {
+					n := block
+					if n > c.remaining() {
+						n = c.remaining()
+					}
+					groups := make([]byte, n)
+					c.extract(groups, 0x0f)
+					for j, group := range groups {
+						if group != byte(i+j)&0x0f {
+							t.Fatalf("Cursor extracted %d from slot %d instead of %d", group, i+j, byte(i+j)&0x0f)
+						}
+					}
+				}
+				if c.remaining() != 0 {
+					t.Errorf("Expected no remaining color channels but got %d", c.remaining())
+				}
+			})
+		}
+	}
+}
+
+func TestSlotsShouldUseOnlySelectedChannels(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 3))
+	s := newTestSlots(t, img, nil, Red|Blue)
+	if s.count != 4*3*2 {
+		t.Errorf("Expected %d color channels but got %d", 4*3*2, s.count)
+	}
+	for i := 0; i < s.count; i++ {
+		*s.at(i) = 0xff
+	}
+	for i, v := range img.Pix {
+		if expected := byte(0xff * (1 - i%2)); v != expected { // only the red and blue channels, at even offsets, are set
+			t.Fatalf("Expected %d at offset %d but got %d", expected, i, v)
+		}
+	}
+}
+
+//newTestSlots returns slots of img as a carrier with given channels.
+func newTestSlots(t *testing.T, img *image.RGBA, key []byte, channels Channels) *slots {
+	carrier, err := newRGBACarrier(img, "png", &Options{Channels: channels})
+	if err != nil {
+		t.Fatalf("Error creating carrier: %v", err)
+	}
+	s, err := newSlots(carrier, key)
+	if err != nil {
+		t.Fatalf("Error creating slots: %v", err)
+	}
+	return s
+}
@@ -1,69 +1,392 @@
 package steg
 
 import (
+	"bytes"
+	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"github.com/DimitarPetrov/stegify/bits"
-	"image"
+	"hash/crc32"
 	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 )
 
+const legacyHeaderReservedBytes = 20 // 20 bytes results in 30 usable bits
+
+//Decoder performs steganography decoding with the configuration given to NewDecoder.
+//It could be reused and it is safe for concurrent use.
+type Decoder struct {
+	opts Options
+}
+
+//NewDecoder returns a Decoder configured by the given options. Without options it decodes just like Decode.
+//Invalid options are reported when decoding.
+func NewDecoder(options ...Option) *Decoder {
+	return &Decoder{opts: newOptions(options)}
+}
+
+//options returns a copy of the options of d, so they could not be changed by a call.
+func (d *Decoder) options() *Options {
+	opts := d.opts
+	return &opts
+}
+
 //Decode performs steganography decoding of Reader with previously encoded data by the Encode function and writes to result Writer.
+//ErrNoPayload is returned if the carrier does not contain encoded data.
 func Decode(carrier io.Reader, result io.Writer) error {
-	RGBAImage, _, err := getImageAsRGBA(carrier)
-	if err != nil {
-		return fmt.Errorf("error parsing carrier image: %v", err)
-	}
+	return DecodeWithOptions(carrier, result, nil)
+}
+
+//DecodeWithOptions performs steganography decoding of Reader with previously encoded data by the Encode function
+//using the given options and writes to result Writer.
+//ErrNoPayload is returned if the carrier does not contain encoded data.
+//The data is written to result as it is decoded, so the memory used does not depend on its length, unless it is encrypted.
+//As the checksum of the data could be verified only after all of it is decoded,
+//the data written to result should be discarded if ErrChecksumMismatch is returned.
+func DecodeWithOptions(carrier io.Reader, result io.Writer, opts *Options) error {
+	_, err := DecodeContext(context.Background(), carrier, result, opts)
+	return err
+}
+
+//DecodeContext performs steganography decoding of Reader with previously encoded data by the Encode function
+//using the given options and writes to result Writer, just like DecodeWithOptions.
+//It returns the information about the original data file recorded when encoding, or nil if none was recorded.
+//The decoding stops with the error of ctx as soon as it is done, in which case the data written to result is incomplete.
+//The progress is reported to Options.Progress.
+func DecodeContext(ctx context.Context, carrier io.Reader, result io.Writer, opts *Options) (*FileInfo, error) {
+	return NewDecoder(WithOptions(opts)).Decode(ctx, carrier, result)
+}
+
+//Decode performs steganography decoding of carrier and writes the data to result as it is decoded, see DecodeWithOptions.
+//It returns the information about the original data file recorded when encoding, or nil if none was recorded.
+//It stops with the error of ctx as soon as it is done, in which case the data written to result is incomplete.
+func (d *Decoder) Decode(ctx context.Context, carrier io.Reader, result io.Writer) (*FileInfo, error) {
+	opts := d.options()
+	return decodeStream(newTask(ctx, opts), []io.Reader{carrier}, result, opts)
+}
+
+//MultiCarrierDecode performs steganography decoding of Readers with previously encoded data chunks by the MultiCarrierEncode function and writes to result Writer.
+//The carriers could be given in any order, a *MissingChunksError is returned if some of them are missing.
+func MultiCarrierDecode(carriers []io.Reader, result io.Writer) error {
+	return MultiCarrierDecodeWithOptions(carriers, result, nil)
+}
 
-	dx := RGBAImage.Bounds().Dx()
-	dy := RGBAImage.Bounds().Dy()
+//MultiCarrierDecodeWithOptions performs steganography decoding of Readers with previously encoded data chunks by the MultiCarrierEncode function
+//using the given options and writes to result Writer.
+//The carriers could be given in any order, a *MissingChunksError is returned if some of them are missing.
+//Carriers encoded with parity or threshold are decoded as long as enough of them are given and intact.
+//Up to Options.Jobs carriers are decoded concurrently, so every carrier should be a separate Reader.
+//Compressed data is decompressed as it is written to result, so the memory used does not depend on its decompressed length.
+//NOTE: When decoding legacy carriers, the order of the carriers MUST be the same as the one when encoding.
+func MultiCarrierDecodeWithOptions(carriers []io.Reader, result io.Writer, opts *Options) error {
+	_, err := MultiCarrierDecodeWithFileInfo(carriers, result, opts)
+	return err
+}
 
-	dataBytes := make([]byte, 0, 2048)
-	resultBytes := make([]byte, 0, 2048)
+//MultiCarrierDecodeWithFileInfo performs steganography decoding of Readers with previously encoded data chunks by the MultiCarrierEncode function
+//using the given options and writes to result Writer, just like MultiCarrierDecodeWithOptions.
+//It returns the information about the original data file recorded when encoding, or nil if none was recorded.
+func MultiCarrierDecodeWithFileInfo(carriers []io.Reader, result io.Writer, opts *Options) (*FileInfo, error) {
+	return MultiCarrierDecodeContext(context.Background(), carriers, result, opts)
+}
+
+//MultiCarrierDecodeContext performs steganography decoding of Readers with previously encoded data chunks by the MultiCarrierEncode function
+//using the given options and writes to result Writer, returning the recorded file info just like MultiCarrierDecodeWithFileInfo.
+//The decoding stops with the error of ctx as soon as it is done. The progress of all carriers is reported to Options.Progress.
+func MultiCarrierDecodeContext(ctx context.Context, carriers []io.Reader, result io.Writer, opts *Options) (*FileInfo, error) {
+	return NewDecoder(WithOptions(opts)).MultiCarrierDecode(ctx, carriers, result)
+}
 
-	dataCount := extractDataCount(RGBAImage)
+//MultiCarrierDecode performs steganography decoding of carriers with previously encoded data chunks, see MultiCarrierDecodeWithOptions,
+//and writes the data to result. It returns the information about the original data file recorded when encoding, or nil if none was recorded.
+//It stops with the error of ctx as soon as it is done.
+func (d *Decoder) MultiCarrierDecode(ctx context.Context, carriers []io.Reader, result io.Writer) (*FileInfo, error) {
+	opts := d.options()
+	return decodeStream(newTask(ctx, opts), carriers, result, opts)
+}
 
-	var count int
+//decodeSet decodes the payload encoded in a set of carriers as part of task t, returning it along with the header of one of its chunks.
+func decodeSet(t *task, carriers []io.Reader, opts *Options) (header, []byte, error) {
+	if len(carriers) == 0 {
+		return header{}, nil, fmt.Errorf("missing carriers")
+	}
+	decoded := make([]chunk, len(carriers))
+	errs := make([]error, len(carriers))
+	_ = forEach(len(carriers), opts.jobs(), func(i int) error {
+		decoded[i].header, decoded[i].data, errs[i] = decode(t, carriers[i], opts)
+		return t.err() // otherwise the chunk could still be reconstructed from the parity chunks or the other shares
+	})
+	if err := t.err(); err != nil {
+		return header{}, nil, err
+	}
 
-	for x := 0; x < dx && dataCount > 0; x++ {
-		for y := 0; y < dy && dataCount > 0; y++ {
-			if count >= dataSizeHeaderReservedBytes {
-				c := RGBAImage.RGBAAt(x, y)
-				dataBytes = append(dataBytes, bits.GetLastTwoBits(c.R), bits.GetLastTwoBits(c.G), bits.GetLastTwoBits(c.B))
-				dataCount -= 3
-			} else {
-				count += 4
+	chunks := make([]chunk, 0, len(carriers))
+	var decodeErr error
+	for i, err := range errs {
+		if err != nil {
+			if decodeErr == nil {
+				decodeErr = fmt.Errorf("error decoding chunk with index %d: %w", i, err)
 			}
+			continue
+		}
+		chunks = append(chunks, decoded[i])
+	}
+	if decodeErr != nil && !redundant(chunks) {
+		return header{}, nil, decodeErr
+	}
+
+	data, err := joinChunks(chunks, opts)
+	if err != nil {
+		if decodeErr != nil {
+			return header{}, nil, decodeErr
+		}
+		return header{}, nil, err
+	}
+	return chunks[0].header, data, nil
+}
+
+//redundant reports whether the chunks are from a set encoded with parity or threshold,
+//so it could be decoded even if some of its carriers fail to be decoded.
+func redundant(chunks []chunk) bool {
+	if len(chunks) == 0 {
+		return false
+	}
+	for _, c := range chunks {
+		if c.header.flags&(flagParity|flagShares) == 0 {
+			return false
 		}
 	}
+	return true
+}
 
-	if dataCount < 0 {
-		dataBytes = dataBytes[:len(dataBytes)+dataCount] //remove bytes that are not part of data and mistakenly added
+//decodeStream decodes the data encoded in carriers and writes it to result as it is decompressed, returning the recorded file info, if any.
+func decodeStream(t *task, carriers []io.Reader, result io.Writer, opts *Options) (*FileInfo, error) {
+	p, err := openPayload(t, carriers, opts)
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(result, p)
+	if err = p.finish(err); err != nil {
+		return nil, err
 	}
+	return p.info, nil
+}
+
+//payloadReader reverses payload as it reads it: it decompresses the data and skips the file info recorded in front of it.
+//The memory used does not depend on the length of the decompressed data.
+type payloadReader struct {
+	io.Reader
+	info   *FileInfo
+	verify func(err error) error
+}
 
-	dataBytes = align(dataBytes) // len(dataBytes) must be aliquot of 4
+//openPayload decodes the header of the payload encoded in carriers and returns reader of its data.
+//The data of a single carrier is decoded as it is read, unless it is encrypted or it is a chunk of data split in multiple carriers.
+//Such data is decoded in memory instead, as the former is authenticated as a whole and the latter could not be used without the rest of its set.
+func openPayload(t *task, carriers []io.Reader, opts *Options) (*payloadReader, error) {
+	if len(carriers) != 1 {
+		h, data, err := decodeSet(t, carriers, opts)
+		if err != nil {
+			return nil, err
+		}
+		return newPayloadReader(h, bytes.NewReader(data), nil)
+	}
 
-	for i := 0; i < len(dataBytes); i += 4 {
-		resultBytes = append(resultBytes, bits.ConstructByteOfQuartersAsSlice(dataBytes[i:i+4]))
+	h, data, err := openData(t, carriers[0], opts)
+	if err != nil {
+		return nil, err
+	}
+	if h.flags&(flagEncrypted|flagChunk) != 0 {
+		resultBytes, err := readData(h, data, opts)
+		if err != nil {
+			return nil, err
+		}
+		if resultBytes, err = joinChunks([]chunk{{header: h, data: resultBytes}}, opts); err != nil {
+			return nil, err
+		}
+		return newPayloadReader(h, bytes.NewReader(resultBytes), nil)
 	}
 
-	if _, err = result.Write(resultBytes); err != nil {
+	checksum := crc32.NewIEEE()
+	payload := io.TeeReader(data, checksum)
+	return newPayloadReader(h, payload, func(err error) error {
+		if _, drainErr := io.Copy(ioutil.Discard, payload); err == nil { // the decompression could stop before the end of the data
+			err = drainErr
+		}
+		if canceled := t.err() != nil && errors.Is(err, t.err()); !canceled && h.flags&flagChecksum != 0 && checksum.Sum32() != h.checksum {
+			return ErrChecksumMismatch // the corruption of the data is reported instead of the errors caused by it
+		}
 		return err
+	})
+}
+
+//newPayloadReader returns reader of the payload data described by h and reads the file info recorded in front of it.
+//The data is verified by verify once it is read, or it is verified already if verify is nil.
+func newPayloadReader(h header, data io.Reader, verify func(err error) error) (*payloadReader, error) {
+	if verify == nil {
+		verify = func(err error) error {
+			return err
+		}
 	}
+	p := &payloadReader{Reader: newDecompressor(data, h.compression), verify: verify}
+	info, err := readFileInfo(h, p.Reader)
+	if err != nil {
+		return nil, verify(err)
+	}
+	p.info = info
+	return p, nil
+}
 
-	return nil
+//finish verifies the data once it is read, given the error of reading it. The error is returned unless the data is corrupted,
+//so the data read should be discarded if an error is returned.
+func (p *payloadReader) finish(err error) error {
+	return p.verify(err)
 }
 
-//MultiCarrierDecode performs steganography decoding of Readers with previously encoded data chunks by the MultiCarrierEncode function and writes to result Writer.
-//NOTE: The order of the carriers MUST be the same as the one when encoding.
-func MultiCarrierDecode(carriers []io.Reader, result io.Writer) error {
-	for i := 0; i < len(carriers); i++ {
-		if err := Decode(carriers[i], result); err != nil {
-			return fmt.Errorf("error decoding chunk with index %d: %v", i, err)
+//decode extracts the header and the data encoded in carrier. The data is verified against the checksum and decrypted if needed.
+func decode(t *task, carrier io.Reader, opts *Options) (header, []byte, error) {
+	h, data, err := openData(t, carrier, opts)
+	if err != nil {
+		return header{}, nil, err
+	}
+	resultBytes, err := readData(h, data, opts)
+	if err != nil {
+		return header{}, nil, err
+	}
+	return h, resultBytes, nil
+}
+
+//readData reads all data described by h, verifies it against the checksum and decrypts it if needed.
+func readData(h header, data *dataReader, opts *Options) ([]byte, error) {
+	resultBytes := make([]byte, data.length())
+	if _, err := io.ReadFull(data, resultBytes); err != nil {
+		return nil, err
+	}
+
+	if h.flags&flagChecksum != 0 && crc32.ChecksumIEEE(resultBytes) != h.checksum {
+		return nil, ErrChecksumMismatch
+	}
+
+	if h.flags&flagEncrypted != 0 {
+		if len(opts.Password) == 0 {
+			return nil, ErrPasswordRequired
+		}
+		var err error
+		if resultBytes, err = unseal(opts.Password, h.salt, h.nonce, resultBytes); err != nil {
+			return nil, err
+		}
+	}
+
+	return resultBytes, nil
+}
+
+//openData extracts the header encoded in carrier and returns it along with reader of the data following it,
+//which reports the progress to t and stops once t is done.
+func openData(t *task, carrier io.Reader, opts *Options) (header, *dataReader, error) {
+	if err := t.err(); err != nil {
+		return header{}, nil, err
+	}
+	if opts.Legacy { // legacy carriers are encoded in all color channels
+		legacyOpts := *opts
+		legacyOpts.Channels = AllChannels
+		opts = &legacyOpts
+	}
+	c, err := decodeCarrier(carrier, opts, true)
+	if err != nil {
+		return header{}, nil, err
+	}
+	if err := t.err(); err != nil {
+		return header{}, nil, err
+	}
+
+	var h header
+	var carrierSlots *slots
+	var dataStart, dataCount int
+	depth := uint(defaultDepth)
+	if opts.Legacy {
+		carrierSlots, _ = newSlots(c, nil)
+		dataStart = legacyHeaderReservedBytes / 4 * 3
+		var ok bool
+		if dataCount, ok = extractLegacyDataCount(carrierSlots); !ok {
+			return header{}, nil, ErrNoPayload
+		}
+		if dataCount > carrierSlots.count-dataStart { // validated before allocating memory for the data
+			return header{}, nil, &LengthExceedsCapacityError{Length: uint64(dataCount) / 4, Capacity: uint64(carrierSlots.count-dataStart) / 4}
+		}
+	} else {
+		carrierSlots, err = newSlots(c, opts.Key)
+		if err != nil {
+			return header{}, nil, err
+		}
+		h, err = extractHeader(carrierSlots)
+		if err != nil {
+			return header{}, nil, err
+		}
+		depth = uint(h.depth)
+		dataStart = dataOffset(h.size())
+		available := 0
+		if carrierSlots.count > dataStart {
+			available = (carrierSlots.count - dataStart) * int(depth) / 8
+		}
+		if h.dataLength > uint64(available) { // validated before allocating memory for the data
+			return header{}, nil, &LengthExceedsCapacityError{Length: h.dataLength, Capacity: uint64(available)}
+		}
+		dataCount = int((h.dataLength*8 + uint64(depth) - 1) / uint64(depth))
+	}
+
+	data := newDataReader(t, carrierSlots.cursor(dataStart), dataCount, depth)
+	t.addTotal(carrierSlots.pixels(carrierSlots.count), int64(data.length()))
+	return h, data, nil
+}
+
+//dataReader reads count groups of depth bits from the samples from the cursor on, straight from the buffer of the carrier,
+//joined in bytes. The groups are extracted in blocks as they are read, so the memory used does not depend on their count.
+type dataReader struct {
+	t      *task
+	c      *cursor
+	count  int // groups left to extract, should not exceed the remaining samples
+	depth  uint
+	groups []byte
+	buf    []byte // bytes extracted but not read yet
+}
+
+func newDataReader(t *task, c *cursor, count int, depth uint) *dataReader {
+	return &dataReader{t: t, c: c, count: count, depth: depth}
+}
+
+//length returns the number of bytes left to read.
+func (r *dataReader) length() int {
+	return len(r.buf) + r.count*int(r.depth)/8
+}
+
+func (r *dataReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.count == 0 {
+			return 0, io.EOF
 		}
+		if err := r.t.err(); err != nil {
+			return 0, err
+		}
+		if r.groups == nil {
+			r.groups = make([]byte, dataBlockGroups) // whole blocks are joined in whole bytes, as their size is a multiple of eight
+		}
+		n := len(r.groups)
+		if r.count < n {
+			n = r.count
+		}
+		pixels := r.c.s.pixels(r.c.i)
+		r.c.extract(r.groups[:n], byte(1)<<r.depth-1)
+		r.buf = bits.JoinBits(r.groups[:n], r.depth)
+		r.count -= n
+		r.t.add(r.c.s.pixels(r.c.i)-pixels, int64(len(r.buf)))
 	}
-	return nil
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
 }
 
 //DecodeByFileNames performs steganography decoding of data previously encoded by the Encode function.
@@ -74,17 +397,67 @@ func DecodeByFileNames(carrierFileName string, resultName string) (err error) {
 
 //MultiCarrierDecodeByFileNames performs steganography decoding of data previously encoded by the MultiCarrierEncode function.
 //The data is decoded from carrier files and it is saved in separate new file
-//NOTE: The order of the carriers MUST be the same as the one when encoding.
+//The carriers could be given in any order, a *MissingChunksError is returned if some of them are missing.
 func MultiCarrierDecodeByFileNames(carrierFileNames []string, resultName string) (err error) {
+	return MultiCarrierDecodeByFileNamesWithOptions(carrierFileNames, resultName, nil)
+}
+
+//MultiCarrierDecodeByFileNamesWithOptions performs steganography decoding of data previously encoded by the MultiCarrierEncode function
+//using the given options.
+//The data is decoded from carrier files and it is saved in separate new file
+//The permissions and modification time of the original data file are restored, if they were recorded when encoding.
+//Archives of multiple data files or directories are extracted in a new directory with the result name instead.
+//The data of a single unencrypted carrier is written to the file as it is decoded, which is removed if it turns out to be corrupted.
+//The carriers could be given in any order, a *MissingChunksError is returned if some of them are missing.
+//NOTE: When decoding legacy carriers, the order of the carriers MUST be the same as the one when encoding.
+func MultiCarrierDecodeByFileNamesWithOptions(carrierFileNames []string, resultName string, opts *Options) (err error) {
+	return NewDecoder(WithOptions(opts)).DecodeFile(context.Background(), carrierFileNames, resultName)
+}
+
+//DecodeFile performs steganography decoding of carrier files and saves the data in new file with given name,
+//see MultiCarrierDecodeByFileNamesWithOptions. It stops with the error of ctx as soon as it is done.
+func (d *Decoder) DecodeFile(ctx context.Context, carrierFileNames []string, resultName string) error {
+	_, err := d.decodeToFile(ctx, carrierFileNames, func(*FileInfo) (string, bool) {
+		return resultName, false
+	})
+	return err
+}
+
+//MultiCarrierDecodeToDir performs steganography decoding of data previously encoded by the MultiCarrierEncode function
+//using the given options.
+//The data is decoded from carrier files and it is saved in new file in outputDir under the original name of the data file,
+//with its permissions and modification time restored, if they were recorded when encoding, or under the name "result" otherwise.
+//An existing file with the recorded name is never overwritten, as the name is chosen by whoever encoded the carriers.
+//Archives of multiple data files or directories are extracted in outputDir with the relative paths of the files preserved.
+//The name of the result file, or outputDir for archives, is returned.
+func MultiCarrierDecodeToDir(carrierFileNames []string, outputDir string, opts *Options) (string, error) {
+	return NewDecoder(WithOptions(opts)).DecodeToDir(context.Background(), carrierFileNames, outputDir)
+}
+
+//DecodeToDir performs steganography decoding of carrier files and saves the data in new file in outputDir under its original name,
+//see MultiCarrierDecodeToDir. It stops with the error of ctx as soon as it is done.
+func (d *Decoder) DecodeToDir(ctx context.Context, carrierFileNames []string, outputDir string) (string, error) {
+	return d.decodeToFile(ctx, carrierFileNames, func(info *FileInfo) (string, bool) {
+		if info != nil && info.Archive {
+			return outputDir, false
+		}
+		return filepath.Join(outputDir, info.baseName()), info != nil
+	})
+}
+
+//decodeToFile decodes the data from carrier files and saves it in new file with name chosen according to the recorded file info,
+//or extracts it in directory with such name if it is an archive. The file is not overwritten if it exists and resultName reports
+//that its name is recorded in the carriers.
+func (d *Decoder) decodeToFile(ctx context.Context, carrierFileNames []string, resultName func(*FileInfo) (string, bool)) (name string, err error) {
 	if len(carrierFileNames) == 0 {
-		return fmt.Errorf("missing carriers names")
+		return "", fmt.Errorf("missing carriers names")
 	}
 
 	carriers := make([]io.Reader, 0, len(carrierFileNames))
 	for _, name := range carrierFileNames {
 		carrier, err := os.Open(name)
 		if err != nil {
-			return fmt.Errorf("error opening carrier file %s: %v", name, err)
+			return "", fmt.Errorf("error opening carrier file %s: %v", name, err)
 		}
 		defer func() {
 			closeErr := carrier.Close()
@@ -95,58 +468,87 @@ func MultiCarrierDecodeByFileNames(carrierFileNames []string, resultName string)
 		carriers = append(carriers, carrier)
 	}
 
-	result, err := os.Create(resultName)
+	opts := d.options()
+	p, err := openPayload(newTask(ctx, opts), carriers, opts)
 	if err != nil {
-		return fmt.Errorf("error creating result file: %v", err)
+		return "", err
 	}
-	defer func() {
-		closeErr := result.Close()
-		if err == nil {
-			err = closeErr
+
+	name, recorded := resultName(p.info)
+	if p.info != nil && p.info.Archive {
+		if err := extractArchive(p, name, p.finish); err != nil {
+			return "", err
 		}
-	}()
+		return name, nil
+	}
 
-	err = MultiCarrierDecode(carriers, result)
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if recorded {
+		flags |= os.O_EXCL
+	}
+	result, err := os.OpenFile(name, flags, 0666)
 	if err != nil {
-		_ = os.Remove(resultName)
+		return "", fmt.Errorf("error creating result file: %v", err)
 	}
-	return err
+	_, err = io.Copy(result, p)
+	err = p.finish(err)
+	if closeErr := result.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = p.info.restore(name)
+	}
+	if err != nil {
+		_ = os.Remove(name)
+		return "", err
+	}
+	return name, nil
 }
 
-func align(dataBytes []byte) []byte {
-	switch len(dataBytes) % 4 {
-	case 1:
-		dataBytes = append(dataBytes, byte(0), byte(0), byte(0))
-	case 2:
-		dataBytes = append(dataBytes, byte(0), byte(0))
-	case 3:
-		dataBytes = append(dataBytes, byte(0))
+func extractHeader(carrierSlots *slots) (header, error) {
+	prefix, ok := extractHeaderBytes(carrierSlots, headerPrefixSize)
+	if !ok {
+		return header{}, ErrNoPayload
+	}
+	h, err := unmarshalHeaderPrefix(prefix)
+	if err != nil {
+		return header{}, err
 	}
-	return dataBytes
+
+	headerBytes, ok := extractHeaderBytes(carrierSlots, h.size())
+	if !ok {
+		return header{}, ErrNoPayload
+	}
+	return unmarshalHeader(headerBytes)
 }
 
-func extractDataCount(RGBAImage *image.RGBA) int {
-	dataCountBytes := make([]byte, 0, 16)
+func extractHeaderBytes(carrierSlots *slots, size int) ([]byte, bool) {
+	if carrierSlots.count < size*4 {
+		return nil, false
+	}
 
-	dx := RGBAImage.Bounds().Dx()
-	dy := RGBAImage.Bounds().Dy()
+	headerGroups := make([]byte, 0, size*4)
+	for i := 0; i < size*4; i++ {
+		headerGroups = append(headerGroups, bits.GetLastBits(*carrierSlots.at(i), headerDepth))
+	}
 
-	count := 0
+	return bits.JoinBits(headerGroups, headerDepth), true
+}
 
-	for x := 0; x < dx && count < dataSizeHeaderReservedBytes; x++ {
-		for y := 0; y < dy && count < dataSizeHeaderReservedBytes; y++ {
-			c := RGBAImage.RGBAAt(x, y)
-			dataCountBytes = append(dataCountBytes, bits.GetLastTwoBits(c.R), bits.GetLastTwoBits(c.G), bits.GetLastTwoBits(c.B))
-			count += 4
-		}
+//extractLegacyDataCount returns the number of quarters of data encoded by legacy stegify versions.
+//False is returned if the carrier is too small to hold the count.
+func extractLegacyDataCount(carrierSlots *slots) (int, bool) {
+	if carrierSlots.count < legacyHeaderReservedBytes/4*3 {
+		return 0, false
 	}
 
-	dataCountBytes = append(dataCountBytes, byte(0))
+	dataCountBytes := make([]byte, 0, 16)
+
+	for i := 0; i < legacyHeaderReservedBytes/4*3; i++ {
+		dataCountBytes = append(dataCountBytes, bits.GetLastBits(*carrierSlots.at(i), 2))
+	}
 
-	var bs = []byte{bits.ConstructByteOfQuartersAsSlice(dataCountBytes[:4]),
-		bits.ConstructByteOfQuartersAsSlice(dataCountBytes[4:8]),
-		bits.ConstructByteOfQuartersAsSlice(dataCountBytes[8:12]),
-		bits.ConstructByteOfQuartersAsSlice(dataCountBytes[12:])}
+	dataCountBytes = append(dataCountBytes, byte(0))
 
-	return int(binary.LittleEndian.Uint32(bs))
+	return int(binary.LittleEndian.Uint32(bits.JoinBits(dataCountBytes, 2))), true
 }
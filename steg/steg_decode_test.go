@@ -1,15 +1,54 @@
 package steg_test
 
 import (
+	"archive/tar"
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"github.com/DimitarPetrov/stegify/steg"
+	"image"
+	"image/png"
 	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func BenchmarkDecode(b *testing.B) {
+	carrier, err := os.Open("../examples/street.jpeg")
+	if err != nil {
+		b.Fatalf("Error opening carrier file: %v", err)
+	}
+	defer carrier.Close()
+
+	data, err := os.Open("../examples/lake.jpeg")
+	if err != nil {
+		b.Fatalf("Error opening data file: %v", err)
+	}
+	defer data.Close()
+
+	var encoded bytes.Buffer
+	err = steg.Encode(carrier, data, &encoded)
+	if err != nil {
+		b.Fatalf("Error encoding file: %v", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var result bytes.Buffer
+
+		err = steg.Decode(bytes.NewReader(encoded.Bytes()), &result)
+		if err != nil {
+			b.Fatalf("Error decoding file: %v", err)
+		}
+	}
+}
+
+func BenchmarkDecodeLegacy(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		carrier, err := os.Open("../examples/test_decode.jpeg")
 		if err != nil {
@@ -18,7 +57,7 @@ func BenchmarkDecode(b *testing.B) {
 
 		var result bytes.Buffer
 
-		err = steg.Decode(carrier, &result)
+		err = steg.DecodeWithOptions(carrier, &result, &steg.Options{Legacy: true})
 		if err != nil {
 			b.Fatalf("Error decoding file: %v", err)
 		}
@@ -29,7 +68,7 @@ func BenchmarkDecode(b *testing.B) {
 
 func BenchmarkDecodeByFileNames(b *testing.B) {
 	for i := 0; i < b.N; i++ {
-		err := steg.DecodeByFileNames("../examples/test_decode.jpeg", "benchmark_result")
+		err := steg.MultiCarrierDecodeByFileNamesWithOptions([]string{"../examples/test_decode.jpeg"}, "benchmark_result", &steg.Options{Legacy: true})
 		if err != nil {
 			b.Fatalf("Error decoding file: %v", err)
 		}
@@ -47,7 +86,7 @@ func TestDecode(t *testing.T) {
 			if len(readers) != 1 {
 				t.Fatalf("Exactly one reader expected")
 			}
-			err := steg.Decode(readers[0], writer)
+			err := steg.DecodeWithOptions(readers[0], writer, &steg.Options{Legacy: true})
 			if err != nil {
 				t.Fatalf("Error decoding file: %v", err)
 			}
@@ -57,7 +96,7 @@ func TestDecode(t *testing.T) {
 func TestMultiCarrierDecode(t *testing.T) {
 	AssertDecodedDataMatchesOriginal(t, []string{"../examples/test_multi_carrier_decode1.jpeg", "../examples/test_multi_carrier_decode2.jpeg"}, "../examples/video.mp4",
 		func(readers []io.Reader, writer io.Writer) {
-			err := steg.MultiCarrierDecode(readers, writer)
+			err := steg.MultiCarrierDecodeWithOptions(readers, writer, &steg.Options{Legacy: true})
 			if err != nil {
 				t.Fatalf("Error decoding file: %v", err)
 			}
@@ -67,19 +106,42 @@ func TestMultiCarrierDecode(t *testing.T) {
 func TestMultiCarrierDecodeOrderMatters(t *testing.T) {
 	AssertDecodedDataDoesNotMatchOriginal(t, []string{"../examples/test_multi_carrier_decode2.jpeg", "../examples/test_multi_carrier_decode1.jpeg"}, "../examples/video.mp4",
 		func(readers []io.Reader, writer io.Writer) {
-			err := steg.MultiCarrierDecode(readers, writer)
+			err := steg.MultiCarrierDecodeWithOptions(readers, writer, &steg.Options{Legacy: true})
 			if err != nil {
 				t.Fatalf("Error decoding file: %v", err)
 			}
 		})
 }
 
+func TestDecodeLegacyCarrier(t *testing.T) {
+	carrier, err := os.Open("../examples/test_multi_carrier_decode2.jpeg")
+	if err != nil {
+		t.Fatalf("Error opening carrier file: %v", err)
+	}
+	defer carrier.Close()
+
+	var result bytes.Buffer
+	err = steg.DecodeWithOptions(carrier, &result, &steg.Options{Legacy: true})
+	if err != nil {
+		t.Fatalf("Error decoding file: %v", err)
+	}
+
+	wantedBytes, err := ioutil.ReadFile("../examples/video.mp4")
+	if err != nil {
+		t.Fatalf("Error reading file examples/video.mp4: %v", err)
+	}
+
+	if !bytes.Equal(wantedBytes[len(wantedBytes)/2:], result.Bytes()) { // the second carrier holds the second half of the data
+		t.Error("Assertion failed!")
+	}
+}
+
 func TestDecodeByFileNames(t *testing.T) {
 	AssertDecodeByFileNames(t, []string{"../examples/test_decode.jpeg"}, "../examples/lake.jpeg", func(strings []string, s string) {
 		if len(strings) != 1 {
 			t.Fatalf("Exactly one carrier expected")
 		}
-		err := steg.DecodeByFileNames(strings[0], s)
+		err := steg.MultiCarrierDecodeByFileNamesWithOptions(strings, s, &steg.Options{Legacy: true})
 		if err != nil {
 			t.Fatalf("Error decoding file: %v", err)
 		}
@@ -88,7 +150,7 @@ func TestDecodeByFileNames(t *testing.T) {
 
 func TestMultiCarrierDecodeByFileNames(t *testing.T) {
 	AssertDecodeByFileNames(t, []string{"../examples/test_multi_carrier_decode1.jpeg", "../examples/test_multi_carrier_decode2.jpeg"}, "../examples/video.mp4", func(strings []string, s string) {
-		err := steg.MultiCarrierDecodeByFileNames(strings, s)
+		err := steg.MultiCarrierDecodeByFileNamesWithOptions(strings, s, &steg.Options{Legacy: true})
 		if err != nil {
 			t.Fatalf("Error decoding file: %v", err)
 		}
@@ -122,6 +184,561 @@ func TestMultiCarrierDecodeByFileNamesShouldReturnErrorWhenNoCarrierFilesProvide
 	t.Log(err)
 }
 
+func TestDecodeShouldReturnErrNoPayloadWhenCarrierHasNoEncodedData(t *testing.T) {
+	carrier, err := os.Open("../examples/street.jpeg")
+	if err != nil {
+		t.Fatalf("Error opening carrier file: %v", err)
+	}
+	defer carrier.Close()
+
+	var result bytes.Buffer
+	err = steg.Decode(carrier, &result)
+	if !errors.Is(err, steg.ErrNoPayload) {
+		t.Fatalf("Expected ErrNoPayload but got: %v", err)
+	}
+	if result.Len() != 0 {
+		t.Error("Expected no data to be written")
+	}
+}
+
+func TestDecodeShouldReturnErrNoPayloadWhenCarrierIsProgressiveJPEG(t *testing.T) {
+	var result bytes.Buffer
+	err := steg.Decode(bytes.NewReader(progressive(newJPEG(t))), &result)
+	if !errors.Is(err, steg.ErrNoPayload) {
+		t.Fatalf("Expected ErrNoPayload but got: %v", err)
+	}
+	if result.Len() != 0 {
+		t.Error("Expected no data to be written")
+	}
+}
+
+func TestMultiCarrierDecodeShouldReturnErrNoPayloadWhenCarrierHasNoEncodedData(t *testing.T) {
+	carrier, err := os.Open("../examples/lake.jpeg")
+	if err != nil {
+		t.Fatalf("Error opening carrier file: %v", err)
+	}
+	defer carrier.Close()
+
+	var result bytes.Buffer
+	err = steg.MultiCarrierDecode([]io.Reader{carrier}, &result)
+	if !errors.Is(err, steg.ErrNoPayload) {
+		t.Fatalf("Expected ErrNoPayload but got: %v", err)
+	}
+	t.Log(err)
+}
+
+func TestMultiCarrierDecodeShouldReturnErrorWhenNoCarriersProvided(t *testing.T) {
+	var result bytes.Buffer
+	err := steg.MultiCarrierDecode([]io.Reader{}, &result)
+	if err == nil {
+		t.FailNow()
+	}
+	t.Log(err)
+}
+
+func TestMultiCarrierDecodeShouldReturnErrNoPayloadWhenOneOfCarriersHasNoEncodedData(t *testing.T) {
+	var single bytes.Buffer
+	if err := steg.Encode(bytes.NewReader(newCarrier(t, 64, 48)), strings.NewReader("hello world"), &single); err != nil {
+		t.Fatalf("Error encoding file: %v", err)
+	}
+	set := []*bytes.Buffer{{}, {}}
+	err := steg.MultiCarrierEncode([]io.Reader{bytes.NewReader(newCarrier(t, 64, 48)), bytes.NewReader(newCarrier(t, 64, 48))},
+		bytes.NewReader(make([]byte, 1024)), []io.Writer{set[0], set[1]})
+	if err != nil {
+		t.Fatalf("Error encoding files: %v", err)
+	}
+
+	var tests = []struct {
+		name     string
+		carriers []io.Reader
+	}{
+		{"Single carrier", []io.Reader{&single, bytes.NewReader(newCarrier(t, 64, 48))}},
+		{"Carrier of a set", []io.Reader{set[0], bytes.NewReader(newCarrier(t, 64, 48))}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var result bytes.Buffer
+			err := steg.MultiCarrierDecode(test.carriers, &result)
+			if !errors.Is(err, steg.ErrNoPayload) {
+				t.Fatalf("Expected ErrNoPayload but got: %v", err)
+			}
+			t.Log(err)
+		})
+	}
+}
+
+func TestDecodeShouldReturnErrChecksumMismatchWhenCarrierIsTampered(t *testing.T) {
+	carrier, err := os.Open("../examples/street.jpeg")
+	if err != nil {
+		t.Fatalf("Error opening carrier file: %v", err)
+	}
+	defer carrier.Close()
+
+	var encodeResult bytes.Buffer
+	err = steg.Encode(carrier, strings.NewReader("some data which is going to be tampered"), &encodeResult)
+	if err != nil {
+		t.Fatalf("Error encoding file: %v", err)
+	}
+
+	img, err := png.Decode(&encodeResult)
+	if err != nil {
+		t.Fatalf("Error decoding encoded image: %v", err)
+	}
+	RGBAImage := img.(*image.RGBA)
+	c := RGBAImage.RGBAAt(0, 40) // a pixel holding data, just after the header
+	c.R ^= 1
+	RGBAImage.SetRGBA(0, 40, c)
+
+	var tampered bytes.Buffer
+	if err = png.Encode(&tampered, RGBAImage); err != nil {
+		t.Fatalf("Error encoding tampered image: %v", err)
+	}
+
+	var result bytes.Buffer
+	err = steg.Decode(&tampered, &result) // the data is written as it is decoded, before the checksum could be verified
+	if !errors.Is(err, steg.ErrChecksumMismatch) {
+		t.Fatalf("Expected ErrChecksumMismatch but got: %v", err)
+	}
+}
+
+func TestDecodeByFileNamesShouldRemoveResultWhenCarrierIsTampered(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stegify")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var encodeResult bytes.Buffer
+	err = steg.Encode(bytes.NewReader(newCarrier(t, 64, 48)), strings.NewReader("some data which is going to be tampered"), &encodeResult)
+	if err != nil {
+		t.Fatalf("Error encoding file: %v", err)
+	}
+	img, err := png.Decode(&encodeResult)
+	if err != nil {
+		t.Fatalf("Error decoding encoded image: %v", err)
+	}
+	RGBAImage := img.(*image.RGBA)
+	c := RGBAImage.RGBAAt(0, 40) // a pixel holding data, just after the header
+	c.R ^= 1
+	RGBAImage.SetRGBA(0, 40, c)
+
+	carrierName := filepath.Join(dir, "carrier.png")
+	carrier, err := os.Create(carrierName)
+	if err != nil {
+		t.Fatalf("Error creating carrier file: %v", err)
+	}
+	err = png.Encode(carrier, RGBAImage)
+	carrier.Close()
+	if err != nil {
+		t.Fatalf("Error encoding tampered image: %v", err)
+	}
+
+	resultName := filepath.Join(dir, "result")
+	err = steg.DecodeByFileNames(carrierName, resultName) // the data is written to the file as it is decoded
+	if !errors.Is(err, steg.ErrChecksumMismatch) {
+		t.Fatalf("Expected ErrChecksumMismatch but got: %v", err)
+	}
+	if _, err := os.Stat(resultName); !os.IsNotExist(err) {
+		t.Error("Expected the result file to be removed")
+	}
+}
+
+//writeRecorder records the sizes of the writes to it.
+type writeRecorder struct {
+	data   bytes.Buffer
+	writes []int
+}
+
+func (w *writeRecorder) Write(p []byte) (int, error) {
+	w.writes = append(w.writes, len(p))
+	return w.data.Write(p)
+}
+
+func TestDecodeShouldWriteDataIncrementally(t *testing.T) {
+	data, err := ioutil.ReadFile("../examples/lake.jpeg")
+	if err != nil {
+		t.Fatalf("Error reading data file: %v", err)
+	}
+
+	var tests = []struct {
+		name string
+		opts *steg.Options
+	}{
+		{"raw", nil},
+		{"with key", &steg.Options{Key: []byte("key")}},
+		{"with compression and file info", &steg.Options{Compression: steg.Deflate, FileInfo: &steg.FileInfo{Name: "lake.jpeg"}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			carrier, err := os.Open("../examples/street.jpeg")
+			if err != nil {
+				t.Fatalf("Error opening carrier file: %v", err)
+			}
+			defer carrier.Close()
+
+			var encodeResult bytes.Buffer
+			if err = steg.EncodeWithOptions(carrier, bytes.NewReader(data), &encodeResult, test.opts); err != nil {
+				t.Fatalf("Error encoding file: %v", err)
+			}
+
+			var result writeRecorder
+			if err = steg.DecodeWithOptions(&encodeResult, &result, test.opts); err != nil {
+				t.Fatalf("Error decoding file: %v", err)
+			}
+			if !bytes.Equal(result.data.Bytes(), data) {
+				t.Error("Decoded data differs from the encoded data")
+			}
+			if len(result.writes) < 2 {
+				t.Errorf("Expected the data to be written in multiple writes but got %d", len(result.writes))
+			}
+			for _, n := range result.writes {
+				if n > 64*1024 {
+					t.Fatalf("Expected the data to be written in small blocks but got a write of %d bytes", n)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeShouldReturnErrChecksumMismatchWhenCompressedDataIsTampered(t *testing.T) {
+	var encodeResult bytes.Buffer
+	data := strings.Repeat("some data which is going to be compressed and tampered ", 100)
+	err := steg.EncodeWithOptions(bytes.NewReader(newCarrier(t, 64, 48)), strings.NewReader(data), &encodeResult, &steg.Options{Compression: steg.Deflate})
+	if err != nil {
+		t.Fatalf("Error encoding file: %v", err)
+	}
+
+	img, err := png.Decode(&encodeResult)
+	if err != nil {
+		t.Fatalf("Error decoding encoded image: %v", err)
+	}
+	RGBAImage := img.(*image.RGBA)
+	for y := 0; y < 48; y++ { // the second column holds compressed data, the header takes the beginning of the first one only
+		c := RGBAImage.RGBAAt(1, y)
+		c.R ^= 3
+		c.G ^= 2
+		RGBAImage.SetRGBA(1, y, c)
+	}
+
+	var tampered bytes.Buffer
+	if err = png.Encode(&tampered, RGBAImage); err != nil {
+		t.Fatalf("Error encoding tampered image: %v", err)
+	}
+
+	err = steg.Decode(&tampered, ioutil.Discard)
+	if !errors.Is(err, steg.ErrChecksumMismatch) {
+		t.Fatalf("Expected ErrChecksumMismatch but got: %v", err)
+	}
+}
+
+func TestDecodeContextShouldStopWhenCanceled(t *testing.T) {
+	carrier, err := os.Open("../examples/street.jpeg")
+	if err != nil {
+		t.Fatalf("Error opening carrier file: %v", err)
+	}
+	defer carrier.Close()
+
+	var encodeResult bytes.Buffer
+	data := bytes.Repeat([]byte("some data "), 100000)
+	if err = steg.Encode(carrier, bytes.NewReader(data), &encodeResult); err != nil {
+		t.Fatalf("Error encoding file: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	opts := &steg.Options{
+		Progress: func(p steg.Progress) {
+			if p.Bytes > 0 {
+				cancel() // cancel in the middle of the decoding
+			}
+		},
+	}
+
+	var result bytes.Buffer
+	_, err = steg.DecodeContext(ctx, &encodeResult, &result, opts)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled but got: %v", err)
+	}
+	if result.Len() == 0 || result.Len() >= len(data) {
+		t.Errorf("Expected part of the data to be written but got %d of %d bytes", result.Len(), len(data))
+	}
+}
+
+func TestDecodeContextShouldReturnFileInfo(t *testing.T) {
+	fileInfo := &steg.FileInfo{Name: "notes.txt", Mode: 0600}
+
+	var encodeResult bytes.Buffer
+	err := steg.EncodeWithOptions(bytes.NewReader(newCarrier(t, 64, 48)), strings.NewReader("hello world"), &encodeResult, &steg.Options{FileInfo: fileInfo})
+	if err != nil {
+		t.Fatalf("Error encoding file: %v", err)
+	}
+
+	var result bytes.Buffer
+	decodedInfo, err := steg.DecodeContext(context.Background(), &encodeResult, &result, nil)
+	if err != nil {
+		t.Fatalf("Error decoding file: %v", err)
+	}
+	if result.String() != "hello world" {
+		t.Errorf("Expected data %q but got %q", "hello world", result.String())
+	}
+	if decodedInfo == nil || decodedInfo.Name != fileInfo.Name || decodedInfo.Mode != fileInfo.Mode {
+		t.Errorf("Expected file info %+v but got %+v", fileInfo, decodedInfo)
+	}
+}
+
+func TestMultiCarrierDecodeWithFileInfo(t *testing.T) {
+	fileInfo := &steg.FileInfo{
+		Name:    "notes.txt",
+		Mode:    0600,
+		ModTime: time.Date(2019, time.November, 7, 12, 30, 0, 0, time.UTC),
+	}
+
+	var encodeResult bytes.Buffer
+	err := steg.EncodeWithOptions(bytes.NewReader(newCarrier(t, 64, 48)), strings.NewReader("hello world"), &encodeResult, &steg.Options{FileInfo: fileInfo})
+	if err != nil {
+		t.Fatalf("Error encoding file: %v", err)
+	}
+
+	var result bytes.Buffer
+	decodedInfo, err := steg.MultiCarrierDecodeWithFileInfo([]io.Reader{&encodeResult}, &result, nil)
+	if err != nil {
+		t.Fatalf("Error decoding file: %v", err)
+	}
+	if result.String() != "hello world" {
+		t.Errorf("Expected data %q but got %q", "hello world", result.String())
+	}
+	if decodedInfo == nil {
+		t.Fatal("Expected file info to be decoded")
+	}
+	if decodedInfo.Name != fileInfo.Name || decodedInfo.Mode != fileInfo.Mode || !decodedInfo.ModTime.Equal(fileInfo.ModTime) {
+		t.Errorf("Expected file info %+v but got %+v", fileInfo, decodedInfo)
+	}
+	if decodedInfo.ContentType != "text/plain; charset=utf-8" {
+		t.Errorf("Expected detected content type but got %q", decodedInfo.ContentType)
+	}
+}
+
+func TestMultiCarrierDecodeToDirShouldNotWriteOutsideOfOutputDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stegify")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	carrierName := filepath.Join(dir, "carrier.png")
+	carrier, err := os.Create(carrierName)
+	if err != nil {
+		t.Fatalf("Error creating carrier file: %v", err)
+	}
+	err = steg.EncodeWithOptions(bytes.NewReader(newCarrier(t, 64, 48)), strings.NewReader("hello world"), carrier,
+		&steg.Options{FileInfo: &steg.FileInfo{Name: "../../escaped"}})
+	carrier.Close()
+	if err != nil {
+		t.Fatalf("Error encoding file: %v", err)
+	}
+
+	outputDir := filepath.Join(dir, "output")
+	if err := os.Mkdir(outputDir, 0755); err != nil {
+		t.Fatalf("Error creating output dir: %v", err)
+	}
+	resultName, err := steg.MultiCarrierDecodeToDir([]string{carrierName}, outputDir, nil)
+	if err != nil {
+		t.Fatalf("Error decoding file: %v", err)
+	}
+	if resultName != filepath.Join(outputDir, "escaped") {
+		t.Errorf("Expected result file %s but got %s", filepath.Join(outputDir, "escaped"), resultName)
+	}
+}
+
+func TestMultiCarrierDecodeToDirShouldNotOverwriteExistingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stegify")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	carrierName := filepath.Join(dir, "carrier.png")
+	carrier, err := os.Create(carrierName)
+	if err != nil {
+		t.Fatalf("Error creating carrier file: %v", err)
+	}
+	err = steg.EncodeWithOptions(bytes.NewReader(newCarrier(t, 64, 48)), strings.NewReader("payload"), carrier,
+		&steg.Options{FileInfo: &steg.FileInfo{Name: ".bashrc", Mode: 0755}})
+	carrier.Close()
+	if err != nil {
+		t.Fatalf("Error encoding file: %v", err)
+	}
+
+	existingName := filepath.Join(dir, ".bashrc")
+	if err := ioutil.WriteFile(existingName, []byte("existing"), 0600); err != nil {
+		t.Fatalf("Error creating existing file: %v", err)
+	}
+	_, err = steg.MultiCarrierDecodeToDir([]string{carrierName}, dir, nil)
+	if err == nil {
+		t.Fatal("Expected error decoding to existing file")
+	}
+	t.Log(err)
+
+	existing, err := ioutil.ReadFile(existingName)
+	if err != nil {
+		t.Fatalf("Error reading existing file: %v", err)
+	}
+	if string(existing) != "existing" {
+		t.Errorf("Expected existing file not to change but got %q", existing)
+	}
+	if stat, err := os.Stat(existingName); err != nil || stat.Mode().Perm() != 0600 {
+		t.Errorf("Expected permissions of existing file not to change: %v", err)
+	}
+}
+
+func TestMultiCarrierDecodeToDirShouldRejectArchiveEntriesOutsideOfOutputDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stegify")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, entryName := range []string{"../escaped", "nested/../../escaped", "/escaped"} {
+		t.Run(entryName, func(t *testing.T) {
+			carrierName := filepath.Join(dir, "carrier.png")
+			writeArchiveCarrier(t, carrierName, "hello", entryName)
+
+			outputDir := filepath.Join(dir, "output")
+			_, err := steg.MultiCarrierDecodeToDir([]string{carrierName}, outputDir, nil)
+			if err == nil {
+				t.Fatal("Expected extraction to fail")
+			}
+			t.Log(err)
+			for _, name := range []string{filepath.Join(dir, "escaped"), "/escaped"} {
+				if _, err := os.Stat(name); !os.IsNotExist(err) {
+					t.Errorf("Expected %s not to be created", name)
+				}
+			}
+		})
+	}
+}
+
+func TestMultiCarrierDecodeToDirShouldNotOverwriteFilesWhenExtractingArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stegify")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	outside := filepath.Join(dir, "outside")
+	if err := os.Mkdir(outside, 0755); err != nil {
+		t.Fatalf("Error creating dir: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(outside, "target"), []byte("existing"), 0644); err != nil {
+		t.Fatalf("Error creating file: %v", err)
+	}
+
+	var tests = []struct {
+		name     string
+		entry    string
+		existing func(outputDir string) error
+	}{
+		{"Existing file", "notes.txt", func(outputDir string) error {
+			return ioutil.WriteFile(filepath.Join(outputDir, "notes.txt"), []byte("existing"), 0644)
+		}},
+		{"Symbolic link to directory", "link/planted", func(outputDir string) error {
+			return os.Symlink(outside, filepath.Join(outputDir, "link"))
+		}},
+		{"Symbolic link to file", "target", func(outputDir string) error {
+			return os.Symlink(filepath.Join(outside, "target"), filepath.Join(outputDir, "target"))
+		}},
+	}
+
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			outputDir := filepath.Join(dir, fmt.Sprint("output", i))
+			if err := os.Mkdir(outputDir, 0755); err != nil {
+				t.Fatalf("Error creating output dir: %v", err)
+			}
+			if err := test.existing(outputDir); err != nil {
+				t.Skipf("Error creating existing entry: %v", err) // symbolic links may not be supported
+			}
+			carrierName := filepath.Join(dir, "carrier.png")
+			writeArchiveCarrier(t, carrierName, "payload", test.entry)
+
+			_, err := steg.MultiCarrierDecodeToDir([]string{carrierName}, outputDir, nil)
+			if err == nil {
+				t.Fatal("Expected extraction to fail")
+			}
+			t.Log(err)
+
+			for _, name := range []string{filepath.Join(outputDir, "notes.txt"), filepath.Join(outside, "target")} {
+				if content, err := ioutil.ReadFile(name); err == nil && string(content) != "existing" {
+					t.Errorf("Expected %s not to change but got %q", name, content)
+				}
+			}
+			if _, err := os.Stat(filepath.Join(outside, "planted")); !os.IsNotExist(err) {
+				t.Error("Expected no file to be created through the symbolic link")
+			}
+		})
+	}
+}
+
+func TestMultiCarrierDecodeToDirShouldRemoveExtractedFilesWhenExtractionFails(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stegify")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	outputDir := filepath.Join(dir, "output")
+	if err := os.Mkdir(outputDir, 0755); err != nil {
+		t.Fatalf("Error creating output dir: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(outputDir, "notes.txt"), []byte("existing"), 0644); err != nil {
+		t.Fatalf("Error creating file: %v", err)
+	}
+	carrierName := filepath.Join(dir, "carrier.png")
+	writeArchiveCarrier(t, carrierName, "payload", "configs/first.txt", "notes.txt")
+
+	_, err = steg.MultiCarrierDecodeToDir([]string{carrierName}, outputDir, nil)
+	if err == nil {
+		t.Fatal("Expected extraction to fail")
+	}
+	t.Log(err)
+	if _, err := os.Stat(filepath.Join(outputDir, "configs")); !os.IsNotExist(err) {
+		t.Error("Expected the extracted entries to be removed")
+	}
+	if content, err := ioutil.ReadFile(filepath.Join(outputDir, "notes.txt")); err != nil || string(content) != "existing" {
+		t.Errorf("Expected existing file to be kept but got %q: %v", content, err)
+	}
+}
+
+//writeArchiveCarrier encodes an archive of files with given names and content in a new carrier file.
+func writeArchiveCarrier(t *testing.T, carrierName, content string, entryNames ...string) {
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	for _, entryName := range entryNames {
+		if err := tw.WriteHeader(&tar.Header{Name: entryName, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatalf("Error writing archive: %v", err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatalf("Error writing archive: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Error writing archive: %v", err)
+	}
+
+	carrier, err := os.Create(carrierName)
+	if err != nil {
+		t.Fatalf("Error creating carrier file: %v", err)
+	}
+	err = steg.EncodeWithOptions(bytes.NewReader(newCarrier(t, 64, 48)), &archive, carrier,
+		&steg.Options{FileInfo: &steg.FileInfo{ContentType: "application/x-tar", Archive: true}, Compression: steg.Deflate})
+	carrier.Close()
+	if err != nil {
+		t.Fatalf("Error encoding file: %v", err)
+	}
+}
+
 func TestDecodeShouldReturnErrorWhenCarrierFileIsNotImage(t *testing.T) {
 	carrier, err := os.Open("../README.md")
 	if err != nil {
@@ -2,120 +2,246 @@ package steg
 
 import (
 	"bytes"
-	"encoding/binary"
+	"context"
 	"fmt"
 	"github.com/DimitarPetrov/stegify/bits"
-	"image"
-	"image/draw"
-	_ "image/jpeg" //register jpeg image format
-	"image/png"
+	"hash/crc32"
 	"io"
 	"io/ioutil"
+	"math"
 	"os"
 )
 
-const dataSizeHeaderReservedBytes = 20 // 20 bytes results in 30 usable bits
+//dataBlockGroups is the number of groups of bits embedded or extracted at once.
+const dataBlockGroups = 1 << 15
+
+//Encoder performs steganography encoding with the configuration given to NewEncoder.
+//It could be reused and it is safe for concurrent use.
+type Encoder struct {
+	opts Options
+}
+
+//NewEncoder returns an Encoder configured by the given options. Without options it encodes just like Encode.
+//Invalid options are reported when encoding.
+func NewEncoder(options ...Option) *Encoder {
+	return &Encoder{opts: newOptions(options)}
+}
+
+//options returns a copy of the options of e, so they could not be changed by a call.
+func (e *Encoder) options() *Options {
+	opts := e.opts
+	return &opts
+}
 
 //Encode performs steganography encoding of data Reader in carrier
-//and writes it to the result Writer encoded as PNG image.
+//and writes it to the result Writer encoded in the result format, see Options.Format.
 func Encode(carrier io.Reader, data io.Reader, result io.Writer) error {
-	RGBAImage, format, err := getImageAsRGBA(carrier)
+	return EncodeWithOptions(carrier, data, result, nil)
+}
+
+//EncodeWithOptions performs steganography encoding of data Reader in carrier using the given options
+//and writes it to the result Writer encoded in the result format, see Options.Format.
+func EncodeWithOptions(carrier io.Reader, data io.Reader, result io.Writer, opts *Options) error {
+	return EncodeContext(context.Background(), carrier, data, result, opts)
+}
+
+//EncodeContext performs steganography encoding of data Reader in carrier using the given options
+//and writes it to the result Writer encoded in the result format, just like EncodeWithOptions.
+//The encoding stops with the error of ctx as soon as it is done, in which case nothing is written to result.
+//The progress is reported to Options.Progress, the total bytes of data become known only when all of it is read.
+func EncodeContext(ctx context.Context, carrier io.Reader, data io.Reader, result io.Writer, opts *Options) error {
+	return NewEncoder(WithOptions(opts)).Encode(ctx, carrier, data, result)
+}
+
+//Encode performs steganography encoding of data Reader in carrier and writes the result carrier to the result Writer.
+//It stops with the error of ctx as soon as it is done, in which case nothing is written to result.
+func (e *Encoder) Encode(ctx context.Context, carrier io.Reader, data io.Reader, result io.Writer) error {
+	opts := e.options()
+	p, err := payload(data, opts)
 	if err != nil {
-		return fmt.Errorf("error parsing carrier image: %v", err)
-	}
-
-	dataBytes := make(chan byte, 128)
-	errChan := make(chan error)
-
-	go readData(data, dataBytes, errChan)
-
-	dx := RGBAImage.Bounds().Dx()
-	dy := RGBAImage.Bounds().Dy()
-
-	hasMoreBytes := true
-
-	var count int
-	var dataCount uint32
-
-	for x := 0; x < dx && hasMoreBytes; x++ {
-		for y := 0; y < dy && hasMoreBytes; y++ {
-			if count >= dataSizeHeaderReservedBytes {
-				c := RGBAImage.RGBAAt(x, y)
-				hasMoreBytes, err = setColorSegment(&c.R, dataBytes, errChan)
-				if err != nil {
-					return err
-				}
-				if hasMoreBytes {
-					dataCount++
-				}
-				hasMoreBytes, err = setColorSegment(&c.G, dataBytes, errChan)
-				if err != nil {
-					return err
-				}
-				if hasMoreBytes {
-					dataCount++
-				}
-				hasMoreBytes, err = setColorSegment(&c.B, dataBytes, errChan)
-				if err != nil {
-					return err
-				}
-				if hasMoreBytes {
-					dataCount++
-				}
-				RGBAImage.SetRGBA(x, y, c)
-			} else {
-				count += 4
-			}
+		return err
+	}
+	defer p.Close()
+	return encode(newTask(ctx, opts), carrier, p, result, opts, nil, false)
+}
+
+//payload returns the data as it is encoded, preceded by the file info record and compressed according to the options.
+//It should be closed to release the resources used by the compression.
+func payload(data io.Reader, opts *Options) (io.ReadCloser, error) {
+	if !opts.Compression.supported() {
+		return nil, fmt.Errorf("unsupported compression %v", opts.Compression)
+	}
+	if opts.FileInfo != nil {
+		var err error
+		if data, err = prependFileInfo(data, opts.FileInfo); err != nil {
+			return nil, err
 		}
 	}
+	return compress(data, opts.Compression), nil
+}
+
+//encode performs steganography encoding of data Reader in carrier as part of task t. If the data is a chunk of data split in multiple carriers,
+//information about the chunk is recorded in the header. If sized, the length of the data is already added to the total progress of t.
+func encode(t *task, carrier io.Reader, data io.Reader, result io.Writer, opts *Options, chunk *chunkInfo, sized bool) error {
+	if err := t.err(); err != nil {
+		return err
+	}
+	c, err := decodeCarrier(carrier, opts, false)
+	if err != nil {
+		return err
+	}
+	if err := t.err(); err != nil {
+		return err
+	}
 
-	select {
-	case _, ok := <-dataBytes: // if there is more data
-		if ok {
-			return fmt.Errorf("data file too large for this carrier")
+	h, err := newHeader(opts, chunk)
+	if err != nil {
+		return err
+	}
+	depth := int(h.depth)
+
+	if h.flags&flagEncrypted != 0 {
+		plainBytes, err := ioutil.ReadAll(data)
+		if err != nil {
+			return fmt.Errorf("error reading data %v", err)
+		}
+		var sealedBytes []byte
+		h.salt, h.nonce, sealedBytes, err = seal(opts.Password, plainBytes)
+		if err != nil {
+			return fmt.Errorf("error encrypting data: %v", err)
+		}
+		data = bytes.NewReader(sealedBytes)
+		if sized {
+			t.addTotal(0, int64(len(sealedBytes)-len(plainBytes))) // the overhead of the encryption
 		}
-	default:
 	}
 
-	setDataSizeHeader(RGBAImage, quartersOfBytesOf(dataCount))
+	carrierSlots, err := newSlots(c, opts.Key)
+	if err != nil {
+		return err
+	}
+
+	t.addTotal(carrierSlots.pixels(carrierSlots.count), 0)
+
+	dataStart := dataOffset(h.size())
+	if carrierSlots.count < dataStart {
+		return fmt.Errorf("carrier too small to hold the payload header")
+	}
+
+	checksum := crc32.NewIEEE()
+	dataLength, err := embedData(t, carrierSlots.cursor(dataStart), io.TeeReader(data, checksum), uint(depth))
+	if err != nil {
+		return err
+	}
+	if !sized {
+		t.addTotal(0, int64(dataLength))
+	}
+
+	h.dataLength = dataLength
+	h.checksum = checksum.Sum32()
+	setHeader(carrierSlots, bits.SplitBits(h.marshal(), headerDepth))
 
-	switch format {
-	case "png", "jpeg":
-		return png.Encode(result, RGBAImage)
-	default:
-		return fmt.Errorf("unsupported carrier format")
+	if err := t.err(); err != nil {
+		return err
 	}
+	return c.Encode(result)
 }
 
-//MultiCarrierEncode performs steganography encoding of data Reader in equal pieces in each of the carriers
-//and writes it to the result Writers encoded as PNG images.
+//MultiCarrierEncode performs steganography encoding of data Reader in pieces proportional to the capacity of each of the carriers
+//and writes it to the result Writers encoded in the result format, see Options.Format.
 func MultiCarrierEncode(carriers []io.Reader, data io.Reader, results []io.Writer) error {
+	return MultiCarrierEncodeWithOptions(carriers, data, results, nil)
+}
+
+//MultiCarrierEncodeWithOptions performs steganography encoding of data Reader in pieces proportional to the capacity of each of the carriers
+//using the given options and writes it to the result Writers encoded in the result format, see Options.Format.
+//With parity the data is split in equal pieces followed by parity pieces instead, see Options.Parity,
+//and with threshold every carrier holds a secret share of the whole data, see Options.Threshold.
+//Up to Options.Jobs carriers are encoded concurrently, so every result should be a separate Writer.
+func MultiCarrierEncodeWithOptions(carriers []io.Reader, data io.Reader, results []io.Writer, opts *Options) error {
+	return MultiCarrierEncodeContext(context.Background(), carriers, data, results, opts)
+}
+
+//MultiCarrierEncodeContext performs steganography encoding of data Reader in pieces in carriers using the given options
+//and writes them to the result Writers encoded in the result format, just like MultiCarrierEncodeWithOptions.
+//The encoding stops with the error of ctx as soon as it is done, in which case some of the results could be incomplete.
+//The progress of all carriers is reported to Options.Progress.
+func MultiCarrierEncodeContext(ctx context.Context, carriers []io.Reader, data io.Reader, results []io.Writer, opts *Options) error {
+	return NewEncoder(WithOptions(opts)).MultiCarrierEncode(ctx, carriers, data, results)
+}
+
+//MultiCarrierEncode performs steganography encoding of data Reader in pieces in carriers, see MultiCarrierEncodeWithOptions,
+//and writes the result carriers to the result Writers. It stops with the error of ctx as soon as it is done,
+//in which case some of the results could be incomplete.
+func (e *Encoder) MultiCarrierEncode(ctx context.Context, carriers []io.Reader, data io.Reader, results []io.Writer) error {
+	opts := e.options()
+
 	if len(carriers) != len(results) {
 		return fmt.Errorf("different number of carriers and results")
 	}
+	if len(carriers) > math.MaxUint16 {
+		return fmt.Errorf("too many carriers, at most %d are supported", math.MaxUint16)
+	}
+	if err := validateRedundancy(len(carriers), opts); err != nil {
+		return err
+	}
+	p, err := payload(data, opts)
+	if err != nil {
+		return err
+	}
+	defer p.Close()
 
-	dataBytes, err := ioutil.ReadAll(data)
+	dataBytes, err := ioutil.ReadAll(p)
 	if err != nil {
 		return fmt.Errorf("error reading data %v", err)
 	}
 
-	chunkSize := len(dataBytes) / len(carriers)
-	dataChunks := make([]io.Reader, 0, len(carriers))
-	chunksCount := 0
-	for i := 0; i < len(dataBytes) && chunksCount < len(carriers); i += chunkSize {
-		chunksCount++
-		if i+chunkSize >= len(dataBytes) || chunksCount == len(carriers) { // last iteration
-			dataChunks = append(dataChunks, bytes.NewReader(dataBytes[i:]))
+	template := chunkTemplate(len(carriers), opts)
+	carrierBytes := make([][]byte, 0, len(carriers))
+	capacities := make([]int, 0, len(carriers))
+	for i, carrier := range carriers {
+		b, err := ioutil.ReadAll(carrier)
+		if err != nil {
+			return fmt.Errorf("error reading carrier with index %d: %v", i, err)
 		}
-		dataChunks = append(dataChunks, bytes.NewReader(dataBytes[i:i+chunkSize]))
+		c, err := capacity(bytes.NewReader(b), opts, template)
+		if err != nil {
+			return fmt.Errorf("error reading carrier with index %d: %v", i, err)
+		}
+		carrierBytes = append(carrierBytes, b)
+		capacities = append(capacities, c)
 	}
 
-	for i := 0; i < len(carriers); i++ {
-		if err := Encode(carriers[i], dataChunks[i], results[i]); err != nil {
-			return fmt.Errorf("error encoding chunk with index %d: %v", i, err)
+	chunks, err := splitData(dataBytes, capacities, opts)
+	if err != nil {
+		return err
+	}
+
+	var setID [setIDSize]byte
+	if template != nil {
+		if setID, err = newSetID(); err != nil {
+			return err
 		}
 	}
-	return nil
+
+	t := newTask(ctx, opts)
+	for _, c := range chunks {
+		t.addTotal(0, int64(len(c)))
+	}
+	return forEach(len(carriers), opts.jobs(), func(i int) error {
+		var info *chunkInfo // nil if a single carrier holds the whole data
+		if template != nil {
+			info = &chunkInfo{setID: setID, index: uint16(i), count: uint16(len(carriers)), parity: template.parity, threshold: template.threshold}
+			if info.parity != 0 {
+				info.setLength = uint64(len(dataBytes))
+			}
+		}
+		if err := encode(t, bytes.NewReader(carrierBytes[i]), bytes.NewReader(chunks[i]), results[i], opts, info, true); err != nil {
+			return fmt.Errorf("error encoding chunk with index %d: %w", i, err)
+		}
+		carrierBytes[i] = nil // release the carrier as soon as possible
+		return nil
+	})
 }
 
 //EncodeByFileNames performs steganography encoding of data file in carrier file
@@ -124,15 +250,43 @@ func EncodeByFileNames(carrierFileName, dataFileName, resultFileName string) (er
 	return MultiCarrierEncodeByFileNames([]string{carrierFileName}, dataFileName, []string{resultFileName})
 }
 
-//MultiCarrierEncodeByFileNames performs steganography encoding of data file in equal pieces in each of the carrier files
+//MultiCarrierEncodeByFileNames performs steganography encoding of data file in pieces proportional to the capacity of each of the carrier files
 //and saves the steganography encoded product in new set of result files.
 func MultiCarrierEncodeByFileNames(carrierFileNames []string, dataFileName string, resultFileNames []string) (err error) {
+	return MultiCarrierEncodeByFileNamesWithOptions(carrierFileNames, dataFileName, resultFileNames, nil)
+}
+
+//MultiCarrierEncodeByFileNamesWithOptions performs steganography encoding of data file in pieces proportional to the capacity of each of the carrier files
+//using the given options and saves the steganography encoded product in new set of result files.
+//The name, permissions and modification time of the data file are recorded too, unless other file info is given in the options.
+//If the data file is a directory, it is packed in a tar archive, see MultiCarrierEncodeFilesByFileNamesWithOptions.
+func MultiCarrierEncodeByFileNamesWithOptions(carrierFileNames []string, dataFileName string, resultFileNames []string, opts *Options) (err error) {
+	return MultiCarrierEncodeFilesByFileNamesWithOptions(carrierFileNames, []string{dataFileName}, resultFileNames, opts)
+}
+
+//MultiCarrierEncodeFilesByFileNamesWithOptions performs steganography encoding of data files and directories in pieces proportional to the capacity
+//of each of the carrier files using the given options and saves the steganography encoded product in new set of result files.
+//A single data file is encoded as it is, while multiple data files or directories are packed in a tar archive,
+//which is extracted with the relative paths of the files preserved when decoding to files.
+//The information about the data files is recorded too, unless other file info is given in the options.
+func MultiCarrierEncodeFilesByFileNamesWithOptions(carrierFileNames []string, dataFileNames []string, resultFileNames []string, opts *Options) (err error) {
+	return NewEncoder(WithOptions(opts)).EncodeFiles(context.Background(), carrierFileNames, dataFileNames, resultFileNames)
+}
+
+//EncodeFiles performs steganography encoding of data files and directories in pieces in carrier files
+//and saves the result carriers in new set of result files, see MultiCarrierEncodeFilesByFileNamesWithOptions.
+//The results are removed if the encoding fails or it is stopped because ctx is done.
+func (e *Encoder) EncodeFiles(ctx context.Context, carrierFileNames []string, dataFileNames []string, resultFileNames []string) (err error) {
+	opts := e.options()
 	if len(carrierFileNames) == 0 {
 		return fmt.Errorf("missing carriers names")
 	}
 	if len(carrierFileNames) != len(resultFileNames) {
 		return fmt.Errorf("different number of carriers and results")
 	}
+	if len(dataFileNames) == 0 {
+		return fmt.Errorf("missing data files names")
+	}
 	carriers := make([]io.Reader, 0, len(carrierFileNames))
 	for _, name := range carrierFileNames {
 		carrier, err := os.Open(name)
@@ -148,9 +302,9 @@ func MultiCarrierEncodeByFileNames(carrierFileNames []string, dataFileName strin
 		carriers = append(carriers, carrier)
 	}
 
-	data, err := os.Open(dataFileName)
+	data, info, err := openDataFiles(dataFileNames)
 	if err != nil {
-		return fmt.Errorf("error opening data file %s: %v", dataFileName, err)
+		return err
 	}
 	defer func() {
 		closeErr := data.Close()
@@ -159,6 +313,10 @@ func MultiCarrierEncodeByFileNames(carrierFileNames []string, dataFileName strin
 		}
 	}()
 
+	if opts.FileInfo == nil {
+		opts.FileInfo = info
+	}
+
 	results := make([]io.Writer, 0, len(resultFileNames))
 	for _, name := range resultFileNames {
 		result, err := os.Create(name)
@@ -174,7 +332,7 @@ func MultiCarrierEncodeByFileNames(carrierFileNames []string, dataFileName strin
 		results = append(results, result)
 	}
 
-	err = MultiCarrierEncode(carriers, data, results)
+	err = NewEncoder(WithOptions(opts)).MultiCarrierEncode(ctx, carriers, data, results)
 	if err != nil {
 		for _, name := range resultFileNames {
 			_ = os.Remove(name)
@@ -183,81 +341,70 @@ func MultiCarrierEncodeByFileNames(carrierFileNames []string, dataFileName strin
 	return err
 }
 
-func quartersOfBytesOf(counter uint32) []byte {
-	bs := make([]byte, 4)
-	binary.LittleEndian.PutUint32(bs, counter)
-	quarters := make([]byte, 16)
-	for i := 0; i < 16; i += 4 {
-		quarters[i] = bits.QuartersOfByte(bs[i/4])[0]
-		quarters[i+1] = bits.QuartersOfByte(bs[i/4])[1]
-		quarters[i+2] = bits.QuartersOfByte(bs[i/4])[2]
-		quarters[i+3] = bits.QuartersOfByte(bs[i/4])[3]
+//openDataFiles returns the data of the files with given names and the information about them.
+//A single regular file is read as it is, otherwise the files and directories are packed in a tar archive.
+func openDataFiles(dataFileNames []string) (io.ReadCloser, *FileInfo, error) {
+	var info *FileInfo
+	if len(dataFileNames) == 1 {
+		file, err := os.Open(dataFileNames[0])
+		if err != nil {
+			return nil, nil, fmt.Errorf("error opening data file %s: %v", dataFileNames[0], err)
+		}
+		stat, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return nil, nil, fmt.Errorf("error reading data file %s: %v", dataFileNames[0], err)
+		}
+		if !stat.IsDir() {
+			return file, newFileInfo(stat), nil
+		}
+		file.Close()
+		info = newFileInfo(stat)
+	} else {
+		info = &FileInfo{}
 	}
 
-	return quarters
-}
-
-func setDataSizeHeader(RGBAImage *image.RGBA, dataCountBytes []byte) {
-	dx := RGBAImage.Bounds().Dx()
-	dy := RGBAImage.Bounds().Dy()
-
-	count := 0
-
-	for x := 0; x < dx && count < (dataSizeHeaderReservedBytes/4)*3; x++ {
-		for y := 0; y < dy && count < (dataSizeHeaderReservedBytes/4)*3; y++ {
-			c := RGBAImage.RGBAAt(x, y)
-			c.R = bits.SetLastTwoBits(c.R, dataCountBytes[count])
-			c.G = bits.SetLastTwoBits(c.G, dataCountBytes[count+1])
-			c.B = bits.SetLastTwoBits(c.B, dataCountBytes[count+2])
-			RGBAImage.SetRGBA(x, y, c)
-
-			count += 3
-
-		}
+	archive, err := packArchive(dataFileNames)
+	if err != nil {
+		return nil, nil, err
 	}
+	info.ContentType = archiveContentType
+	info.Archive = true
+	return ioutil.NopCloser(bytes.NewReader(archive)), info, nil
 }
 
-func setColorSegment(colorSegment *byte, data <-chan byte, errChan <-chan error) (hasMoreBytes bool, err error) {
-	select {
-	case byte, ok := <-data:
-		if !ok {
-			return false, nil
-		}
-		*colorSegment = bits.SetLastTwoBits(*colorSegment, byte)
-		return true, nil
-
-	case err := <-errChan:
-		return false, err
-
+func setHeader(carrierSlots *slots, headerGroups []byte) {
+	for i, group := range headerGroups {
+		colorSegment := carrierSlots.at(i)
+		*colorSegment = bits.SetLastBits(*colorSegment, group, headerDepth)
 	}
 }
 
-func readData(reader io.Reader, bytes chan<- byte, errChan chan<- error) {
-	b := make([]byte, 1)
+//embedData reads data in blocks and sets its groups of depth bits in the samples from the cursor on,
+//writing straight into the buffer of the carrier. The number of bytes embedded is returned.
+//The progress is reported to t after every block and the embedding stops once t is done.
+func embedData(t *task, c *cursor, data io.Reader, depth uint) (uint64, error) {
+	mask := byte(1)<<depth - 1
+	block := make([]byte, dataBlockGroups/8*depth) // depth bytes are split in exactly eight groups of depth bits
+	var length uint64
 	for {
-		if _, err := reader.Read(b); err != nil {
-			if err == io.EOF {
-				break
-			}
-			errChan <- fmt.Errorf("error reading data %v", err)
-			return
+		if err := t.err(); err != nil {
+			return 0, err
 		}
-		for _, b := range bits.QuartersOfByte(b[0]) {
-			bytes <- b
+		n, err := io.ReadFull(data, block)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, fmt.Errorf("error reading data %v", err)
+		}
+		groups := bits.SplitBits(block[:n], depth)
+		if len(groups) > c.remaining() {
+			return 0, fmt.Errorf("data file too large for this carrier")
+		}
+		pixels := c.s.pixels(c.i)
+		c.embed(groups, mask)
+		length += uint64(n)
+		t.add(c.s.pixels(c.i)-pixels, int64(n))
+		if err != nil {
+			return length, nil
 		}
-
-	}
-	close(bytes)
-}
-
-func getImageAsRGBA(reader io.Reader) (*image.RGBA, string, error) {
-	img, format, err := image.Decode(reader)
-	if err != nil {
-		return nil, format, fmt.Errorf("error decoding carrier image: %v", err)
 	}
-
-	RGBAImage := image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
-	draw.Draw(RGBAImage, RGBAImage.Bounds(), img, img.Bounds().Min, draw.Src)
-
-	return RGBAImage, format, nil
 }
@@ -2,10 +2,17 @@ package steg_test
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
 	"github.com/DimitarPetrov/stegify/steg"
+	"image"
+	"image/png"
 	"io"
 	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -65,6 +72,34 @@ func TestEncode(t *testing.T) {
 		})
 }
 
+func TestEncodeShouldMatchGoldenResult(t *testing.T) {
+	data := make([]byte, 9000) // spans more than one block of data
+	for i := range data {
+		data[i] = byte(i * 31 >> 3)
+	}
+	var encodeResult bytes.Buffer
+	if err := steg.Encode(bytes.NewReader(newCarrier(t, 128, 96)), bytes.NewReader(data), &encodeResult); err != nil {
+		t.Fatalf("Error encoding data: %v", err)
+	}
+
+	golden, err := os.Open("../examples/test_encode_golden.png") // encoded by the versions walking the carrier column by column
+	if err != nil {
+		t.Fatalf("Error opening golden file: %v", err)
+	}
+	defer golden.Close()
+	expected, err := png.Decode(golden)
+	if err != nil {
+		t.Fatalf("Error decoding golden file: %v", err)
+	}
+	actual, err := png.Decode(&encodeResult)
+	if err != nil {
+		t.Fatalf("Error decoding result: %v", err)
+	}
+	if !bytes.Equal(actual.(*image.RGBA).Pix, expected.(*image.RGBA).Pix) {
+		t.Error("Expected result to match the golden file")
+	}
+}
+
 func TestMultiCarrierEncode(t *testing.T) {
 	AssertEncode(t, []string{"../examples/street.jpeg", "../examples/lake.jpeg"}, "../examples/video.mp4",
 		func(readers []io.Reader, reader io.Reader, writer io.Writer) {
@@ -82,6 +117,800 @@ func TestMultiCarrierEncode(t *testing.T) {
 		})
 }
 
+func TestMultiCarrierDecodeShouldAcceptCarriersInAnyOrder(t *testing.T) {
+	AssertEncode(t, []string{"../examples/street.jpeg", "../examples/lake.jpeg"}, "../examples/video.mp4",
+		func(readers []io.Reader, reader io.Reader, writer io.Writer) {
+			var encodeResult1 bytes.Buffer
+			var encodeResult2 bytes.Buffer
+			err := steg.MultiCarrierEncode(readers, reader, []io.Writer{&encodeResult1, &encodeResult2})
+			if err != nil {
+				t.Fatalf("Error encoding files: %v", err)
+			}
+
+			err = steg.MultiCarrierDecode([]io.Reader{&encodeResult2, &encodeResult1}, writer)
+			if err != nil {
+				t.Fatalf("Error decoding files: %v", err)
+			}
+		})
+}
+
+func TestMultiCarrierDecodeShouldReportMissingChunks(t *testing.T) {
+	carriers := make([]io.Reader, 0, 4)
+	results := make([]*bytes.Buffer, 0, 4)
+	for i := 0; i < 4; i++ {
+		carriers = append(carriers, bytes.NewReader(newCarrier(t, 64, 48)))
+		results = append(results, &bytes.Buffer{})
+	}
+
+	err := steg.MultiCarrierEncode(carriers, bytes.NewReader(make([]byte, 2048)), []io.Writer{results[0], results[1], results[2], results[3]})
+	if err != nil {
+		t.Fatalf("Error encoding files: %v", err)
+	}
+
+	var result bytes.Buffer
+	err = steg.MultiCarrierDecode([]io.Reader{results[2], results[0]}, &result)
+	var missingChunksErr *steg.MissingChunksError
+	if !errors.As(err, &missingChunksErr) {
+		t.Fatalf("Expected MissingChunksError but got: %v", err)
+	}
+	if fmt.Sprint(missingChunksErr.Indices) != "[1 3]" || missingChunksErr.Count != 4 {
+		t.Errorf("Expected missing chunks [1 3] of 4 but got %v of %d", missingChunksErr.Indices, missingChunksErr.Count)
+	}
+	t.Log(err)
+}
+
+func TestMultiCarrierDecodeShouldRejectCarriersFromDifferentSets(t *testing.T) {
+	encodeSet := func() []*bytes.Buffer {
+		results := []*bytes.Buffer{{}, {}}
+		err := steg.MultiCarrierEncode([]io.Reader{bytes.NewReader(newCarrier(t, 64, 48)), bytes.NewReader(newCarrier(t, 64, 48))},
+			bytes.NewReader(make([]byte, 1024)), []io.Writer{results[0], results[1]})
+		if err != nil {
+			t.Fatalf("Error encoding files: %v", err)
+		}
+		return results
+	}
+	set1 := encodeSet()
+	set2 := encodeSet()
+
+	var result bytes.Buffer
+	err := steg.MultiCarrierDecode([]io.Reader{set1[0], set2[1]}, &result)
+	if err == nil {
+		t.FailNow()
+	}
+	t.Log(err)
+}
+
+func TestMultiCarrierDecodeShouldRejectCarriersEncodedSeparately(t *testing.T) {
+	results := []*bytes.Buffer{{}, {}}
+	for i, data := range []string{"hello world", "SECOND"} {
+		if err := steg.Encode(bytes.NewReader(newCarrier(t, 64, 48)), strings.NewReader(data), results[i]); err != nil {
+			t.Fatalf("Error encoding file: %v", err)
+		}
+	}
+
+	var result bytes.Buffer
+	err := steg.MultiCarrierDecode([]io.Reader{results[1], results[0]}, &result)
+	if err == nil {
+		t.Fatalf("Expected error but decoded %q", result.String())
+	}
+	t.Log(err)
+}
+
+func TestMultiCarrierEncodeWithParity(t *testing.T) {
+	data := make([]byte, 3000)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatalf("Error generating data: %v", err)
+	}
+
+	carriers := make([]io.Reader, 0, 4)
+	writers := make([]io.Writer, 0, 4)
+	results := make([][]byte, 0, 4)
+	buffers := make([]*bytes.Buffer, 0, 4)
+	for i := 0; i < 4; i++ {
+		carriers = append(carriers, bytes.NewReader(newCarrier(t, 64+i, 48)))
+		buffers = append(buffers, &bytes.Buffer{})
+		writers = append(writers, buffers[i])
+	}
+	err := steg.MultiCarrierEncodeWithOptions(carriers, bytes.NewReader(data), writers, &steg.Options{Parity: 2})
+	if err != nil {
+		t.Fatalf("Error encoding files: %v", err)
+	}
+	for _, buffer := range buffers {
+		results = append(results, buffer.Bytes())
+	}
+
+	for i := 0; i < 4; i++ {
+		for j := i + 1; j < 4; j++ {
+			t.Run(fmt.Sprintf("decode from carriers %d and %d", i, j), func(t *testing.T) {
+				var result bytes.Buffer
+				err := steg.MultiCarrierDecode([]io.Reader{bytes.NewReader(results[j]), bytes.NewReader(results[i])}, &result)
+				if err != nil {
+					t.Fatalf("Error decoding files: %v", err)
+				}
+				if !bytes.Equal(result.Bytes(), data) {
+					t.Error("Decoded data does not match the original")
+				}
+			})
+		}
+	}
+
+	t.Run("decode with damaged carriers", func(t *testing.T) {
+		var result bytes.Buffer
+		err := steg.MultiCarrierDecode([]io.Reader{bytes.NewReader(newCarrier(t, 64, 48)), bytes.NewReader(results[1]), bytes.NewReader(results[3])}, &result)
+		if err != nil {
+			t.Fatalf("Error decoding files: %v", err)
+		}
+		if !bytes.Equal(result.Bytes(), data) {
+			t.Error("Decoded data does not match the original")
+		}
+	})
+
+	t.Run("decode from too few carriers", func(t *testing.T) {
+		var result bytes.Buffer
+		err := steg.MultiCarrierDecode([]io.Reader{bytes.NewReader(results[2])}, &result)
+		var missingChunksErr *steg.MissingChunksError
+		if !errors.As(err, &missingChunksErr) {
+			t.Fatalf("Expected MissingChunksError but got: %v", err)
+		}
+		if fmt.Sprint(missingChunksErr.Indices) != "[0 1 3]" || missingChunksErr.Required != 2 {
+			t.Errorf("Expected missing chunks [0 1 3] with 2 required but got %v with %d required", missingChunksErr.Indices, missingChunksErr.Required)
+		}
+		t.Log(err)
+	})
+}
+
+func TestMultiCarrierEncodeShouldReturnErrorWhenParityIsInvalid(t *testing.T) {
+	for _, parity := range []int{-1, 2, 3} {
+		t.Run(fmt.Sprintf("parity %d", parity), func(t *testing.T) {
+			err := steg.MultiCarrierEncodeWithOptions([]io.Reader{bytes.NewReader(newCarrier(t, 64, 48)), bytes.NewReader(newCarrier(t, 64, 48))},
+				bytes.NewReader(make([]byte, 16)), []io.Writer{ioutil.Discard, ioutil.Discard}, &steg.Options{Parity: parity})
+			if err == nil {
+				t.FailNow()
+			}
+			t.Log(err)
+		})
+	}
+}
+
+func TestMultiCarrierEncodeWithThreshold(t *testing.T) {
+	data := make([]byte, 1000)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatalf("Error generating data: %v", err)
+	}
+
+	carriers := make([]io.Reader, 0, 5)
+	writers := make([]io.Writer, 0, 5)
+	buffers := make([]*bytes.Buffer, 0, 5)
+	for i := 0; i < 5; i++ {
+		carriers = append(carriers, bytes.NewReader(newCarrier(t, 64, 48+i)))
+		buffers = append(buffers, &bytes.Buffer{})
+		writers = append(writers, buffers[i])
+	}
+	err := steg.MultiCarrierEncodeWithOptions(carriers, bytes.NewReader(data), writers, &steg.Options{Threshold: 3})
+	if err != nil {
+		t.Fatalf("Error encoding files: %v", err)
+	}
+	results := make([][]byte, 0, 5)
+	for _, buffer := range buffers {
+		results = append(results, buffer.Bytes())
+	}
+
+	for _, indices := range [][]int{{0, 1, 2}, {4, 2, 0}, {1, 3, 4}, {0, 1, 2, 3, 4}} {
+		t.Run(fmt.Sprintf("decode from carriers %v", indices), func(t *testing.T) {
+			readers := make([]io.Reader, 0, len(indices))
+			for _, i := range indices {
+				readers = append(readers, bytes.NewReader(results[i]))
+			}
+			var result bytes.Buffer
+			if err := steg.MultiCarrierDecode(readers, &result); err != nil {
+				t.Fatalf("Error decoding files: %v", err)
+			}
+			if !bytes.Equal(result.Bytes(), data) {
+				t.Error("Decoded data does not match the original")
+			}
+		})
+	}
+
+	t.Run("decode from too few carriers", func(t *testing.T) {
+		var result bytes.Buffer
+		err := steg.MultiCarrierDecode([]io.Reader{bytes.NewReader(results[3]), bytes.NewReader(results[1])}, &result)
+		var missingChunksErr *steg.MissingChunksError
+		if !errors.As(err, &missingChunksErr) {
+			t.Fatalf("Expected MissingChunksError but got: %v", err)
+		}
+		if missingChunksErr.Required != 3 {
+			t.Errorf("Expected 3 required chunks but got %d", missingChunksErr.Required)
+		}
+		t.Log(err)
+	})
+}
+
+func TestMultiCarrierEncodeShouldReturnErrorWhenThresholdIsInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		opts *steg.Options
+	}{
+		{name: "threshold 1", opts: &steg.Options{Threshold: 1}},
+		{name: "threshold above carriers count", opts: &steg.Options{Threshold: 3}},
+		{name: "threshold with parity", opts: &steg.Options{Threshold: 2, Parity: 1}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := steg.MultiCarrierEncodeWithOptions([]io.Reader{bytes.NewReader(newCarrier(t, 64, 48)), bytes.NewReader(newCarrier(t, 64, 48))},
+				bytes.NewReader(make([]byte, 16)), []io.Writer{ioutil.Discard, ioutil.Discard}, test.opts)
+			if err == nil {
+				t.FailNow()
+			}
+			t.Log(err)
+		})
+	}
+}
+
+func TestMultiCarrierEncodeShouldSplitDataProportionallyToCapacity(t *testing.T) {
+	thumbnail := newCarrier(t, 64, 48) // fits about a kilobyte, far less than half of the data
+
+	AssertEncode(t, []string{"../examples/street.jpeg"}, "../examples/lake.jpeg",
+		func(readers []io.Reader, reader io.Reader, writer io.Writer) {
+			var encodeResult1 bytes.Buffer
+			var encodeResult2 bytes.Buffer
+			err := steg.MultiCarrierEncode([]io.Reader{bytes.NewReader(thumbnail), readers[0]}, reader, []io.Writer{&encodeResult1, &encodeResult2})
+			if err != nil {
+				t.Fatalf("Error encoding files: %v", err)
+			}
+
+			err = steg.MultiCarrierDecode([]io.Reader{&encodeResult1, &encodeResult2}, writer)
+			if err != nil {
+				t.Fatalf("Error decoding files: %v", err)
+			}
+		})
+}
+
+func TestEncodeWithPassword(t *testing.T) {
+	AssertEncode(t, []string{"../examples/street.jpeg"}, "../examples/lake.jpeg",
+		func(readers []io.Reader, reader io.Reader, writer io.Writer) {
+			opts := &steg.Options{Password: []byte("secret")}
+			var encodeResult bytes.Buffer
+			err := steg.EncodeWithOptions(readers[0], reader, &encodeResult, opts)
+			if err != nil {
+				t.Fatalf("Error encoding files: %v", err)
+			}
+
+			err = steg.DecodeWithOptions(&encodeResult, writer, opts)
+			if err != nil {
+				t.Fatalf("Error decoding files: %v", err)
+			}
+		})
+}
+
+func TestMultiCarrierEncodeWithPassword(t *testing.T) {
+	AssertEncode(t, []string{"../examples/street.jpeg", "../examples/lake.jpeg"}, "../examples/video.mp4",
+		func(readers []io.Reader, reader io.Reader, writer io.Writer) {
+			opts := &steg.Options{Password: []byte("secret")}
+			var encodeResult1 bytes.Buffer
+			var encodeResult2 bytes.Buffer
+			err := steg.MultiCarrierEncodeWithOptions(readers, reader, []io.Writer{&encodeResult1, &encodeResult2}, opts)
+			if err != nil {
+				t.Fatalf("Error encoding files: %v", err)
+			}
+
+			err = steg.MultiCarrierDecodeWithOptions([]io.Reader{&encodeResult1, &encodeResult2}, writer, opts)
+			if err != nil {
+				t.Fatalf("Error decoding files: %v", err)
+			}
+		})
+}
+
+func TestEncodeWithPasswordShouldNotBeDecodableWithoutIt(t *testing.T) {
+	tests := []struct {
+		name     string
+		password []byte
+		err      error
+	}{
+		{name: "No password", password: nil, err: steg.ErrPasswordRequired},
+		{name: "Wrong password", password: []byte("wrong"), err: steg.ErrWrongPassword},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			carrier, err := os.Open("../examples/street.jpeg")
+			if err != nil {
+				t.Fatalf("Error opening carrier file: %v", err)
+			}
+			defer carrier.Close()
+
+			var encodeResult bytes.Buffer
+			err = steg.EncodeWithOptions(carrier, bytes.NewReader([]byte("top secret")), &encodeResult, &steg.Options{Password: []byte("secret")})
+			if err != nil {
+				t.Fatalf("Error encoding file: %v", err)
+			}
+
+			var result bytes.Buffer
+			err = steg.DecodeWithOptions(&encodeResult, &result, &steg.Options{Password: test.password})
+			if !errors.Is(err, test.err) {
+				t.Fatalf("Expected %v but got: %v", test.err, err)
+			}
+			if result.Len() != 0 {
+				t.Error("Expected no data to be written")
+			}
+		})
+	}
+}
+
+func TestEncodeWithKey(t *testing.T) {
+	AssertEncode(t, []string{"../examples/street.jpeg"}, "../examples/lake.jpeg",
+		func(readers []io.Reader, reader io.Reader, writer io.Writer) {
+			opts := &steg.Options{Key: []byte("key")}
+			var encodeResult bytes.Buffer
+			err := steg.EncodeWithOptions(readers[0], reader, &encodeResult, opts)
+			if err != nil {
+				t.Fatalf("Error encoding files: %v", err)
+			}
+
+			err = steg.DecodeWithOptions(&encodeResult, writer, opts)
+			if err != nil {
+				t.Fatalf("Error decoding files: %v", err)
+			}
+		})
+}
+
+func TestEncodeWithKeyShouldScatterDataAcrossWholeCarrier(t *testing.T) {
+	carrierBytes, err := ioutil.ReadFile("../examples/street.jpeg")
+	if err != nil {
+		t.Fatalf("Error reading carrier file: %v", err)
+	}
+	carrier, _, err := image.Decode(bytes.NewReader(carrierBytes))
+	if err != nil {
+		t.Fatalf("Error decoding carrier image: %v", err)
+	}
+
+	var encodeResult bytes.Buffer
+	data := bytes.Repeat([]byte{0x5a}, 4096)
+	err = steg.EncodeWithOptions(bytes.NewReader(carrierBytes), bytes.NewReader(data), &encodeResult, &steg.Options{Key: []byte("key")})
+	if err != nil {
+		t.Fatalf("Error encoding file: %v", err)
+	}
+	encoded, err := png.Decode(&encodeResult)
+	if err != nil {
+		t.Fatalf("Error decoding encoded image: %v", err)
+	}
+
+	bounds := carrier.Bounds()
+	var changedInQuadrant [4]int
+	for x := bounds.Min.X; x < bounds.Max.X; x++ {
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			r1, g1, b1, _ := carrier.At(x, y).RGBA()
+			r2, g2, b2, _ := encoded.At(x-bounds.Min.X, y-bounds.Min.Y).RGBA()
+			if r1>>8 != r2>>8 || g1>>8 != g2>>8 || b1>>8 != b2>>8 {
+				quadrant := 0
+				if x-bounds.Min.X >= bounds.Dx()/2 {
+					quadrant++
+				}
+				if y-bounds.Min.Y >= bounds.Dy()/2 {
+					quadrant += 2
+				}
+				changedInQuadrant[quadrant]++
+			}
+		}
+	}
+
+	for quadrant, changed := range changedInQuadrant {
+		if changed == 0 {
+			t.Errorf("Expected changed pixels in quadrant %d, but got %v", quadrant, changedInQuadrant)
+		}
+	}
+}
+
+func TestEncodeWithKeyShouldNotBeDecodableWithoutIt(t *testing.T) {
+	carrier, err := os.Open("../examples/street.jpeg")
+	if err != nil {
+		t.Fatalf("Error opening carrier file: %v", err)
+	}
+	defer carrier.Close()
+
+	var encodeResult bytes.Buffer
+	err = steg.EncodeWithOptions(carrier, bytes.NewReader([]byte("top secret")), &encodeResult, &steg.Options{Key: []byte("key")})
+	if err != nil {
+		t.Fatalf("Error encoding file: %v", err)
+	}
+
+	var result bytes.Buffer
+	err = steg.Decode(&encodeResult, &result)
+	if !errors.Is(err, steg.ErrNoPayload) {
+		t.Fatalf("Expected ErrNoPayload but got: %v", err)
+	}
+}
+
+func TestEncodeWithDepth(t *testing.T) {
+	for depth := 1; depth <= 4; depth++ {
+		t.Run(fmt.Sprintf("Depth %d", depth), func(t *testing.T) {
+			AssertEncode(t, []string{"../examples/street.jpeg"}, "../examples/lake.jpeg",
+				func(readers []io.Reader, reader io.Reader, writer io.Writer) {
+					var encodeResult bytes.Buffer
+					err := steg.EncodeWithOptions(readers[0], reader, &encodeResult, &steg.Options{Depth: depth})
+					if err != nil {
+						t.Fatalf("Error encoding files: %v", err)
+					}
+
+					err = steg.Decode(&encodeResult, writer) // depth is detected automatically
+					if err != nil {
+						t.Fatalf("Error decoding files: %v", err)
+					}
+				})
+		})
+	}
+}
+
+func TestEncodeWithCompression(t *testing.T) {
+	data := []byte(strings.Repeat("stegify hides data in images. ", 1000))
+	carrier := newCarrier(t, 64, 48)
+	opts := &steg.Options{Compression: steg.Deflate}
+
+	capacity, err := steg.Capacity(bytes.NewReader(carrier), opts)
+	if err != nil {
+		t.Fatalf("Error calculating capacity: %v", err)
+	}
+	size, err := steg.PayloadSize(bytes.NewReader(data), opts)
+	if err != nil {
+		t.Fatalf("Error calculating payload size: %v", err)
+	}
+	if len(data) <= capacity || size > capacity {
+		t.Fatalf("Expected only the compressed data of %d bytes to fit in %d bytes but got %d bytes", len(data), capacity, size)
+	}
+
+	var encodeResult bytes.Buffer
+	err = steg.EncodeWithOptions(bytes.NewReader(carrier), bytes.NewReader(data), &encodeResult, opts)
+	if err != nil {
+		t.Fatalf("Error encoding file: %v", err)
+	}
+
+	var result bytes.Buffer
+	err = steg.Decode(&encodeResult, &result) // compression is detected automatically
+	if err != nil {
+		t.Fatalf("Error decoding file: %v", err)
+	}
+	if !bytes.Equal(result.Bytes(), data) {
+		t.Error("Decoded data does not match the original")
+	}
+}
+
+func TestMultiCarrierEncodeWithCompression(t *testing.T) {
+	AssertEncode(t, []string{"../examples/street.jpeg", "../examples/lake.jpeg"}, "../examples/video.mp4",
+		func(readers []io.Reader, reader io.Reader, writer io.Writer) {
+			var encodeResult1 bytes.Buffer
+			var encodeResult2 bytes.Buffer
+			err := steg.MultiCarrierEncodeWithOptions(readers, reader, []io.Writer{&encodeResult1, &encodeResult2}, &steg.Options{Compression: steg.Deflate})
+			if err != nil {
+				t.Fatalf("Error encoding files: %v", err)
+			}
+
+			err = steg.MultiCarrierDecode([]io.Reader{&encodeResult1, &encodeResult2}, writer)
+			if err != nil {
+				t.Fatalf("Error decoding files: %v", err)
+			}
+		})
+}
+
+func TestMultiCarrierEncodeWithJobs(t *testing.T) {
+	for _, jobs := range []int{1, 2, 8} {
+		t.Run(fmt.Sprintf("%d jobs", jobs), func(t *testing.T) {
+			AssertEncode(t, []string{"../examples/street.jpeg", "../examples/lake.jpeg", "../examples/street.jpeg"}, "../examples/video.mp4",
+				func(readers []io.Reader, reader io.Reader, writer io.Writer) {
+					encodeResults := []*bytes.Buffer{{}, {}, {}}
+					opts := &steg.Options{Jobs: jobs}
+					err := steg.MultiCarrierEncodeWithOptions(readers, reader, []io.Writer{encodeResults[0], encodeResults[1], encodeResults[2]}, opts)
+					if err != nil {
+						t.Fatalf("Error encoding files: %v", err)
+					}
+
+					err = steg.MultiCarrierDecodeWithOptions([]io.Reader{encodeResults[2], encodeResults[0], encodeResults[1]}, writer, opts)
+					if err != nil {
+						t.Fatalf("Error decoding files: %v", err)
+					}
+				})
+		})
+	}
+}
+
+func TestMultiCarrierEncodeContextShouldReportProgress(t *testing.T) {
+	AssertEncode(t, []string{"../examples/street.jpeg", "../examples/lake.jpeg"}, "../examples/video.mp4",
+		func(readers []io.Reader, reader io.Reader, writer io.Writer) {
+			var reports []steg.Progress
+			opts := &steg.Options{
+				Progress: func(p steg.Progress) {
+					reports = append(reports, p)
+				},
+			}
+
+			var encodeResult1 bytes.Buffer
+			var encodeResult2 bytes.Buffer
+			err := steg.MultiCarrierEncodeContext(context.Background(), readers, reader, []io.Writer{&encodeResult1, &encodeResult2}, opts)
+			if err != nil {
+				t.Fatalf("Error encoding files: %v", err)
+			}
+			assertProgress(t, reports)
+
+			reports = nil
+			_, err = steg.MultiCarrierDecodeContext(context.Background(), []io.Reader{&encodeResult1, &encodeResult2}, writer, opts)
+			if err != nil {
+				t.Fatalf("Error decoding files: %v", err)
+			}
+			assertProgress(t, reports)
+		})
+}
+
+func assertProgress(t *testing.T, reports []steg.Progress) {
+	if len(reports) < 2 {
+		t.Fatalf("Expected multiple progress reports but got %d", len(reports))
+	}
+	for i := 1; i < len(reports); i++ {
+		if reports[i].Bytes < reports[i-1].Bytes || reports[i].Pixels < reports[i-1].Pixels {
+			t.Fatalf("Expected progress to grow but got %+v after %+v", reports[i], reports[i-1])
+		}
+	}
+	last := reports[len(reports)-1]
+	if last.Bytes == 0 || last.Bytes != last.TotalBytes {
+		t.Errorf("Expected all bytes to be processed but got %+v", last)
+	}
+	if last.Pixels == 0 || last.Pixels > last.TotalPixels {
+		t.Errorf("Expected processed pixels to be within the total but got %+v", last)
+	}
+}
+
+func TestEncodeContextShouldStopWhenCanceled(t *testing.T) {
+	carrier, err := os.Open("../examples/street.jpeg")
+	if err != nil {
+		t.Fatalf("Error opening carrier file: %v", err)
+	}
+	defer carrier.Close()
+
+	data, err := os.Open("../examples/lake.jpeg")
+	if err != nil {
+		t.Fatalf("Error opening data file: %v", err)
+	}
+	defer data.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var last steg.Progress
+	opts := &steg.Options{
+		Progress: func(p steg.Progress) {
+			last = p
+			if p.Bytes > 0 {
+				cancel() // cancel in the middle of the encoding
+			}
+		},
+	}
+
+	var result bytes.Buffer
+	err = steg.EncodeContext(ctx, carrier, data, &result, opts)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled but got: %v", err)
+	}
+	if stat, err := data.Stat(); err != nil || last.Bytes >= stat.Size() {
+		t.Errorf("Expected encoding to stop before all data is embedded but got %+v", last)
+	}
+	if result.Len() != 0 {
+		t.Error("Expected no result to be written")
+	}
+}
+
+func TestMultiCarrierEncodeContextShouldStopWhenCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var encodeResult1 bytes.Buffer
+	var encodeResult2 bytes.Buffer
+	carriers := []io.Reader{bytes.NewReader(newCarrier(t, 64, 48)), bytes.NewReader(newCarrier(t, 64, 48))}
+	err := steg.MultiCarrierEncodeContext(ctx, carriers, strings.NewReader("some data"), []io.Writer{&encodeResult1, &encodeResult2}, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled but got: %v", err)
+	}
+}
+
+func TestEncoderShouldBeReusableConcurrently(t *testing.T) {
+	encoder := steg.NewEncoder(steg.WithDepth(3), steg.WithKey([]byte("key")), steg.WithCompression(steg.Deflate), steg.WithPNGCompression(png.BestSpeed))
+	decoder := steg.NewDecoder(steg.WithKey([]byte("key")))
+	carrier := newCarrier(t, 64, 48)
+
+	errs := make(chan error, 4)
+	for i := 0; i < cap(errs); i++ {
+		go func(data string) {
+			var encodeResult bytes.Buffer
+			if err := encoder.Encode(context.Background(), bytes.NewReader(carrier), strings.NewReader(data), &encodeResult); err != nil {
+				errs <- fmt.Errorf("error encoding data %q: %v", data, err)
+				return
+			}
+			var result bytes.Buffer
+			if _, err := decoder.Decode(context.Background(), &encodeResult, &result); err != nil {
+				errs <- fmt.Errorf("error decoding data %q: %v", data, err)
+				return
+			}
+			if result.String() != data {
+				errs <- fmt.Errorf("expected data %q but got %q", data, result.String())
+				return
+			}
+			errs <- nil
+		}(fmt.Sprintf("data number %d", i))
+	}
+
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestEncodeWithChannels(t *testing.T) {
+	carrier := newCarrier(t, 64, 48)
+	original, err := png.Decode(bytes.NewReader(carrier))
+	if err != nil {
+		t.Fatalf("Error decoding carrier image: %v", err)
+	}
+
+	encoder := steg.NewEncoder(steg.WithChannels(steg.Red | steg.Blue))
+	var encodeResult bytes.Buffer
+	data := strings.Repeat("data hidden in the red and blue channels only ", 20)
+	if err = encoder.Encode(context.Background(), bytes.NewReader(carrier), strings.NewReader(data), &encodeResult); err != nil {
+		t.Fatalf("Error encoding data: %v", err)
+	}
+
+	encoded, err := png.Decode(bytes.NewReader(encodeResult.Bytes()))
+	if err != nil {
+		t.Fatalf("Error decoding encoded image: %v", err)
+	}
+	var changed bool
+	for x := 0; x < 64; x++ {
+		for y := 0; y < 48; y++ {
+			r1, g1, b1, _ := original.At(x, y).RGBA()
+			r2, g2, b2, _ := encoded.At(x, y).RGBA()
+			if g1 != g2 {
+				t.Fatalf("Expected green channel of pixel (%d, %d) to be unchanged", x, y)
+			}
+			changed = changed || r1 != r2 || b1 != b2
+		}
+	}
+	if !changed {
+		t.Error("Expected red and blue channels to be changed")
+	}
+
+	var result bytes.Buffer
+	if _, err = steg.NewDecoder(steg.WithChannels(steg.Red|steg.Blue)).Decode(context.Background(), bytes.NewReader(encodeResult.Bytes()), &result); err != nil {
+		t.Fatalf("Error decoding data: %v", err)
+	}
+	if result.String() != data {
+		t.Errorf("Expected data %q but got %q", data, result.String())
+	}
+
+	err = steg.Decode(bytes.NewReader(encodeResult.Bytes()), &result)
+	if err == nil {
+		t.Fatal("Expected error when decoding without the same channels")
+	}
+	t.Log(err)
+}
+
+func TestEncodeWithPNGCompression(t *testing.T) {
+	carrier := newCarrier(t, 64, 48)
+	sizes := make(map[png.CompressionLevel]int)
+	for _, level := range []png.CompressionLevel{png.NoCompression, png.BestCompression} {
+		var encodeResult bytes.Buffer
+		if err := steg.NewEncoder(steg.WithPNGCompression(level)).Encode(context.Background(), bytes.NewReader(carrier), strings.NewReader("some data"), &encodeResult); err != nil {
+			t.Fatalf("Error encoding data: %v", err)
+		}
+		sizes[level] = encodeResult.Len()
+
+		var result bytes.Buffer
+		if err := steg.Decode(&encodeResult, &result); err != nil {
+			t.Fatalf("Error decoding data: %v", err)
+		}
+		if result.String() != "some data" {
+			t.Errorf("Expected data %q but got %q", "some data", result.String())
+		}
+	}
+	if sizes[png.NoCompression] <= sizes[png.BestCompression] {
+		t.Errorf("Expected uncompressed result to be larger than compressed one but got sizes %v", sizes)
+	}
+}
+
+func TestEncodeWithMaxPixelsShouldNotLimitCarriers(t *testing.T) {
+	carrier := newCarrier(t, 64, 48)
+	opts := &steg.Options{MaxPixels: 64 * 47} // smaller than the carrier
+
+	if _, err := steg.Capacity(bytes.NewReader(carrier), opts); err != nil {
+		t.Fatalf("Error computing capacity: %v", err)
+	}
+	var encodeResult bytes.Buffer
+	if err := steg.EncodeWithOptions(bytes.NewReader(carrier), strings.NewReader("some data"), &encodeResult, opts); err != nil {
+		t.Fatalf("Error encoding data: %v", err)
+	}
+
+	var result bytes.Buffer
+	_, err := steg.NewDecoder(steg.WithMaxPixels(opts.MaxPixels)).Decode(context.Background(), bytes.NewReader(encodeResult.Bytes()), &result)
+	if err == nil {
+		t.Fatal("Expected decoding of result larger than the limit to fail")
+	}
+	t.Log(err)
+
+	result.Reset()
+	if _, err := steg.NewDecoder(steg.WithMaxPixels(64*48)).Decode(context.Background(), &encodeResult, &result); err != nil {
+		t.Fatalf("Error decoding data: %v", err)
+	}
+	if result.String() != "some data" {
+		t.Errorf("Expected data %q but got %q", "some data", result.String())
+	}
+}
+
+func TestEncodeShouldReturnErrorWhenOptionsAreUnsupported(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []steg.Option
+	}{
+		{name: "Unsupported format", options: []steg.Option{steg.WithFormat("jpeg")}},
+		{name: "Unsupported channels", options: []steg.Option{steg.WithChannels(8)}},
+		{name: "Unsupported depth", options: []steg.Option{steg.WithDepth(5)}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var result bytes.Buffer
+			err := steg.NewEncoder(test.options...).Encode(context.Background(), bytes.NewReader(newCarrier(t, 16, 16)), strings.NewReader("data"), &result)
+			if err == nil {
+				t.Fatal("Expected error")
+			}
+			t.Log(err)
+		})
+	}
+}
+
+func TestParseChannels(t *testing.T) {
+	tests := []struct {
+		name     string
+		channels steg.Channels
+		valid    bool
+	}{
+		{"RGB", steg.AllChannels, true},
+		{"rb", steg.Red | steg.Blue, true},
+		{"G", steg.Green, true},
+		{"", 0, false},
+		{"RR", 0, false},
+		{"RA", 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			channels, err := steg.ParseChannels(test.name)
+			if test.valid != (err == nil) {
+				t.Fatalf("Expected valid %v but got error: %v", test.valid, err)
+			}
+			if channels != test.channels {
+				t.Errorf("Expected channels %v but got %v", test.channels, channels)
+			}
+			if test.valid && channels.String() != strings.ToUpper(test.name) {
+				t.Errorf("Expected name %s but got %s", strings.ToUpper(test.name), channels.String())
+			}
+		})
+	}
+}
+
+func TestEncodeShouldReturnErrorWhenDepthIsUnsupported(t *testing.T) {
+	for _, depth := range []int{-1, 5, 8} {
+		t.Run(fmt.Sprintf("Depth %d", depth), func(t *testing.T) {
+			carrier, err := os.Open("../examples/street.jpeg")
+			if err != nil {
+				t.Fatalf("Error opening carrier file: %v", err)
+			}
+			defer carrier.Close()
+
+			var result bytes.Buffer
+			err = steg.EncodeWithOptions(carrier, bytes.NewReader([]byte("data")), &result, &steg.Options{Depth: depth})
+			if err == nil {
+				t.FailNow()
+			}
+			t.Log(err)
+		})
+	}
+}
+
 func TestEncodeByFileNames(t *testing.T) {
 	err := steg.EncodeByFileNames("../examples/street.jpeg", "../examples/lake.jpeg", "encoded_result.jpeg")
 	if err != nil {
@@ -0,0 +1,167 @@
+package steg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+const (
+	wavFormatPCM        = 1
+	wavFormatExtensible = 0xfffe
+
+	maxWAVFormatSize = 1 << 10 // the "fmt " chunk takes a few dozen bytes, so larger ones are rejected before allocating them
+)
+
+func init() {
+	RegisterCarrierFormat(CarrierFormat{Name: "wav", Magic: "RIFF????WAVE", Decode: decodeWAVCarrier, Samples: wavCarrierSamples})
+}
+
+//wavCarrier is a RIFF WAV audio carrier with 8, 16 or 24 bit PCM samples, in which the data is encoded
+//in the least significant byte of every sample. The samples are ordered as they are stored, frame by frame.
+//The whole file is kept, so the sample rate, the channels and any other chunks are preserved in the result.
+type wavCarrier struct {
+	file []byte
+	wav  wavInfo
+}
+
+//wavInfo describes the samples of a WAV file.
+type wavInfo struct {
+	channels    int
+	sampleBytes int   // bytes of every sample
+	data        int64 // offset of the samples in the file
+	count       int   // number of samples of all channels
+}
+
+func decodeWAVCarrier(r io.Reader, _ *Options) (Carrier, error) {
+	file, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading carrier audio: %v", err)
+	}
+	wav, err := readWAV(bytes.NewReader(file))
+	if err != nil {
+		return nil, err
+	}
+	return &wavCarrier{file: file, wav: wav}, nil
+}
+
+func wavCarrierSamples(r io.Reader, _ *Options) (int, error) {
+	wav, err := readWAV(r)
+	if err != nil {
+		return 0, err
+	}
+	return wav.count, nil
+}
+
+func (c *wavCarrier) Buffer() []byte {
+	return c.file
+}
+
+func (c *wavCarrier) Len() int {
+	return c.wav.count
+}
+
+//Offset returns the offset of the least significant byte of the sample, which comes first as the samples are little endian.
+func (c *wavCarrier) Offset(i int) int {
+	return int(c.wav.data) + i*c.wav.sampleBytes
+}
+
+//Encode writes the WAV file with the changed samples.
+func (c *wavCarrier) Encode(w io.Writer) error {
+	_, err := w.Write(c.file)
+	return err
+}
+
+//readWAV reads the RIFF chunks of a WAV file from r up to its "fmt " and "data" chunks, which describe the samples.
+//The contents of the data chunk are skipped.
+func readWAV(r io.Reader) (wavInfo, error) {
+	var riff [12]byte
+	if _, err := io.ReadFull(r, riff[:]); err != nil {
+		return wavInfo{}, fmt.Errorf("error decoding carrier audio: %v", wavReadError(err))
+	}
+	if string(riff[:4]) != "RIFF" || string(riff[8:]) != "WAVE" {
+		return wavInfo{}, fmt.Errorf("error decoding carrier audio: not a WAV file")
+	}
+
+	var wav wavInfo
+	var formatFound, dataFound bool
+	var dataSize int64
+	offset := int64(len(riff))
+	for !formatFound || !dataFound {
+		var chunk [8]byte
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			return wavInfo{}, fmt.Errorf("error decoding carrier audio: %v", wavReadError(err))
+		}
+		id, size := string(chunk[:4]), int64(binary.LittleEndian.Uint32(chunk[4:]))
+		offset += int64(len(chunk))
+
+		var err error
+		switch {
+		case id == "fmt " && !formatFound:
+			if size > maxWAVFormatSize {
+				return wavInfo{}, fmt.Errorf("error decoding carrier audio: WAV format of %d bytes too large", size)
+			}
+			body := make([]byte, size)
+			if _, err = io.ReadFull(r, body); err == nil {
+				wav, err = parseWAVFormat(body, wav)
+			}
+			formatFound = true
+		case id == "data" && !dataFound:
+			wav.data, dataSize = offset, size
+			_, err = io.CopyN(ioutil.Discard, r, size)
+			dataFound = true
+		default:
+			_, err = io.CopyN(ioutil.Discard, r, size)
+		}
+		if err != nil {
+			return wavInfo{}, fmt.Errorf("error decoding carrier audio: %v", wavReadError(err))
+		}
+		offset += size
+
+		if size%2 != 0 && (!formatFound || !dataFound) { // the chunks are padded to even sizes
+			if _, err := io.CopyN(ioutil.Discard, r, 1); err != nil {
+				return wavInfo{}, fmt.Errorf("error decoding carrier audio: %v", wavReadError(err))
+			}
+			offset++
+		}
+	}
+
+	frameBytes := int64(wav.channels * wav.sampleBytes)
+	wav.count = int(dataSize / frameBytes * int64(wav.channels)) // only whole frames are used
+	return wav, nil
+}
+
+//parseWAVFormat parses the body of the "fmt " chunk of a WAV file into wav. Only PCM samples of 8, 16 or 24 bits are supported.
+func parseWAVFormat(body []byte, wav wavInfo) (wavInfo, error) {
+	if len(body) < 16 {
+		return wavInfo{}, fmt.Errorf("WAV format truncated")
+	}
+	format := binary.LittleEndian.Uint16(body)
+	channels := int(binary.LittleEndian.Uint16(body[2:]))
+	blockAlign := int(binary.LittleEndian.Uint16(body[12:]))
+	bits := int(binary.LittleEndian.Uint16(body[14:]))
+	if format == wavFormatExtensible && len(body) >= 26 {
+		format = binary.LittleEndian.Uint16(body[24:]) // the first bytes of the sub format GUID
+	}
+	if format != wavFormatPCM {
+		return wavInfo{}, fmt.Errorf("unsupported WAV format %#x, only PCM is supported", format)
+	}
+	if bits != 8 && bits != 16 && bits != 24 {
+		return wavInfo{}, fmt.Errorf("unsupported WAV sample size of %d bits", bits)
+	}
+	if channels == 0 || blockAlign != channels*bits/8 {
+		return wavInfo{}, fmt.Errorf("invalid WAV format with %d channels and block align %d", channels, blockAlign)
+	}
+	wav.channels, wav.sampleBytes = channels, bits/8
+	return wav, nil
+}
+
+//wavReadError reports missing bytes of a WAV file as truncation.
+func wavReadError(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("WAV file truncated")
+	}
+	return err
+}
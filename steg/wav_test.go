@@ -0,0 +1,132 @@
+package steg_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"github.com/DimitarPetrov/stegify/steg"
+	"testing"
+)
+
+//newWAV returns a PCM WAV file with given channels and bits per sample, holding frames of pseudo-random samples
+//surrounded by chunks of other kinds.
+func newWAV(channels, bits, frames int) []byte {
+	var body bytes.Buffer
+	body.WriteString("WAVE")
+	writeChunk := func(id string, data []byte) {
+		body.WriteString(id)
+		binary.Write(&body, binary.LittleEndian, uint32(len(data)))
+		body.Write(data)
+		if len(data)%2 != 0 {
+			body.WriteByte(0)
+		}
+	}
+
+	format := make([]byte, 16)
+	binary.LittleEndian.PutUint16(format, 1)
+	binary.LittleEndian.PutUint16(format[2:], uint16(channels))
+	binary.LittleEndian.PutUint32(format[4:], 44100)
+	binary.LittleEndian.PutUint32(format[8:], uint32(44100*channels*bits/8))
+	binary.LittleEndian.PutUint16(format[12:], uint16(channels*bits/8))
+	binary.LittleEndian.PutUint16(format[14:], uint16(bits))
+	writeChunk("fmt ", format)
+	writeChunk("LIST", []byte("INFOISFT\x03\x00\x00\x00abc"))
+
+	samples := make([]byte, frames*channels*bits/8)
+	for i := range samples {
+		samples[i] = byte(i*7 + i/3)
+	}
+	writeChunk("data", samples)
+	writeChunk("cue ", []byte("trailing"))
+
+	var file bytes.Buffer
+	file.WriteString("RIFF")
+	binary.Write(&file, binary.LittleEndian, uint32(body.Len()))
+	file.Write(body.Bytes())
+	return file.Bytes()
+}
+
+func TestEncodeWithWAVCarrier(t *testing.T) {
+	data := bytes.Repeat([]byte("hidden in audio "), 100)
+	var tests = []struct {
+		name     string
+		channels int
+		bits     int
+		opts     *steg.Options
+	}{
+		{"8 bit mono", 1, 8, nil},
+		{"16 bit stereo", 2, 16, nil},
+		{"24 bit stereo", 2, 24, nil},
+		{"16 bit scattered", 2, 16, &steg.Options{Key: []byte("key"), Depth: 1}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			carrier := newWAV(test.channels, test.bits, 8000)
+
+			var result bytes.Buffer
+			if err := steg.EncodeWithOptions(bytes.NewReader(carrier), bytes.NewReader(data), &result, test.opts); err != nil {
+				t.Fatalf("Error encoding data: %v", err)
+			}
+			if result.Len() != len(carrier) {
+				t.Fatalf("Expected result of %d bytes but got %d", len(carrier), result.Len())
+			}
+			sampleBytes := test.bits / 8
+			dataStart := bytes.Index(carrier, []byte("data")) + 8
+			for i, b := range result.Bytes() {
+				isSampleLSB := i >= dataStart && i < dataStart+8000*test.channels*sampleBytes && (i-dataStart)%sampleBytes == 0
+				if !isSampleLSB && b != carrier[i] {
+					t.Fatalf("Expected byte at offset %d not to change", i)
+				}
+			}
+
+			var decoded bytes.Buffer
+			if err := steg.DecodeWithOptions(&result, &decoded, test.opts); err != nil {
+				t.Fatalf("Error decoding data: %v", err)
+			}
+			if !bytes.Equal(decoded.Bytes(), data) {
+				t.Errorf("Decoded data does not match the original")
+			}
+		})
+	}
+}
+
+func TestCapacityOfWAVCarrier(t *testing.T) {
+	capacity, err := steg.Capacity(bytes.NewReader(newWAV(2, 16, 8000)), nil)
+	if err != nil {
+		t.Fatalf("Error calculating capacity: %v", err)
+	}
+
+	data := make([]byte, capacity)
+	var result bytes.Buffer
+	if err := steg.NewEncoder().Encode(context.Background(), bytes.NewReader(newWAV(2, 16, 8000)), bytes.NewReader(data), &result); err != nil {
+		t.Fatalf("Error encoding data of the capacity: %v", err)
+	}
+	if err := steg.NewEncoder().Encode(context.Background(), bytes.NewReader(newWAV(2, 16, 8000)), bytes.NewReader(append(data, 0)), &result); err == nil {
+		t.Fatalf("Expected error encoding data exceeding the capacity")
+	}
+}
+
+func TestEncodeShouldReturnErrorWhenWAVCarrierIsUnsupported(t *testing.T) {
+	float := newWAV(1, 16, 100)
+	float[20] = 3 // IEEE float format
+	var tests = []struct {
+		name    string
+		carrier []byte
+	}{
+		{"Float samples", float},
+		{"32 bit samples", newWAV(1, 32, 100)},
+		{"Truncated samples", newWAV(1, 16, 100)[:100]},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var result bytes.Buffer
+			err := steg.Encode(bytes.NewReader(test.carrier), bytes.NewReader([]byte("data")), &result)
+			if err == nil {
+				t.Fatalf("Expected error encoding in unsupported carrier")
+			}
+			t.Log(err)
+		})
+	}
+}
@@ -1,16 +1,18 @@
-//Command line tool capable of steganography encoding and decoding any file within given images as carriers
+//Command line tool capable of steganography encoding and decoding any file within given images or WAV audio files as carriers
 package main
 
 import (
 	"flag"
 	"fmt"
 	"github.com/DimitarPetrov/stegify/steg"
+	"io/ioutil"
 	"os"
 	"strings"
 )
 
 const encode = "encode"
 const decode = "decode"
+const capacity = "capacity"
 
 type sliceFlag []string
 
@@ -25,22 +27,62 @@ func (sf *sliceFlag) Set(value string) error {
 
 var carrierFilesSlice sliceFlag
 var carrierFiles = flag.String("carriers", "", "carrier files in which the data is encoded (separated by space)")
-var dataFile = flag.String("data", "", "data file which is being encoded in the carrier")
+var dataFiles sliceFlag
 var resultFilesSlice sliceFlag
 var resultFiles = flag.String("results", "", "names of the result files (separated by space)")
+var outputDir = flag.String("output-dir", ".", "directory in which the decoded file is saved under its original name, unless a result name is given")
+var legacy = flag.Bool("legacy", false, "decode carriers encoded by stegify versions without payload header")
+var password = flag.String("password", "", "password used for encryption of the data when encoding and decryption when decoding")
+var passwordFile = flag.String("password-file", "", "file containing the password used for encryption/decryption of the data (alternative to --password)")
+var depth = flag.Int("depth", 0, "number of least significant bits of every color channel used for encoding the data, from 1 to 4 (2 by default)")
+var format = flag.String("format", "", "format of the results of encoding image carriers: png, gif for paletted carriers or jpeg for JPEG carriers encoded in their DCT coefficients (png or the format of paletted carriers by default)")
+var key = flag.String("key", "", "key from which the pseudo-random order of scattering the data across the carriers is derived")
+var shares = flag.Int("shares", 0, "number of secret shares the data is split into, one per carrier (should match the number of carriers)")
+var threshold = flag.Int("threshold", 0, "number of secret shares required for decoding, while fewer reveal nothing about the data")
+var compression compressionFlag
+var parity = flag.Int("parity", 0, "number of carriers holding parity data, so that any of the carriers but that many are enough for decoding")
+var jobs = flag.Int("jobs", 0, "maximum number of carriers processed concurrently (the number of CPUs by default)")
+var maxPixels = flag.Int("max-pixels", 0, "maximum number of pixels of image carriers when decoding, negative for no limit (268435456 by default)")
+
+//compressionFlag is a flag selecting the compression algorithm, which could also be given without a value for the default one.
+type compressionFlag struct {
+	steg.Compression
+}
+
+func (cf *compressionFlag) IsBoolFlag() bool {
+	return true
+}
+
+func (cf *compressionFlag) Set(value string) error {
+	switch value {
+	case "true":
+		cf.Compression = steg.Deflate
+	case "false":
+		cf.Compression = steg.NoCompression
+	default:
+		c, err := steg.ParseCompression(value)
+		if err != nil {
+			return err
+		}
+		cf.Compression = c
+	}
+	return nil
+}
 
 func init() {
+	flag.Var(&compression, "compress", "compress the data before encoding it, optionally with given algorithm [deflate] (--compress=deflate)")
 	flag.StringVar(carrierFiles, "c", "", "carrier files in which the data is encoded (separated by space, shorthand for --carriers)")
 	flag.Var(&carrierFilesSlice, "carrier", "carrier file in which the data is encoded (could be used multiple times for multiple carriers)")
-	flag.StringVar(dataFile, "d", "", "data file which is being encoded in the carrier (shorthand for --data)")
+	flag.Var(&dataFiles, "data", "data file or directory which is being encoded in the carrier (could be used multiple times for multiple data files packed in an archive)")
+	flag.Var(&dataFiles, "d", "data file or directory which is being encoded in the carrier (shorthand for --data)")
 	flag.Var(&resultFilesSlice, "result", "name of the result file (could be used multiple times for multiple result file names)")
 	flag.StringVar(resultFiles, "r", "", "names of the result files (separated by space, shorthand for --results)")
 
 	flag.Usage = func() {
-		fmt.Fprintln(os.Stdout, "Usage: stegify [encode/decode] [flags...]")
+		fmt.Fprintln(os.Stdout, "Usage: stegify [encode/decode/capacity] [flags...]")
 		flag.PrintDefaults()
 		fmt.Fprintln(os.Stdout, `NOTE: When multiple carriers are provided with different kinds of flags, the names provided through "carrier" flag are taken first and with "carriers"/"c" flags second. Same goes for the "result"/"results" flags.`)
-		fmt.Fprintln(os.Stdout, `NOTE: When no results are provided a default values will be used for the names of the results.`)
+		fmt.Fprintln(os.Stdout, `NOTE: When no results are provided a default values will be used for the names of the results. When decoding, the original name of the data file is used if it was recorded.`)
 	}
 }
 
@@ -49,6 +91,26 @@ func main() {
 	flag.Parse()
 	carriers := parseCarriers()
 	results := parseResults()
+	opts := &steg.Options{
+		Legacy:      *legacy,
+		Password:    parsePassword(),
+		Key:         []byte(*key),
+		Depth:       *depth,
+		Format:      *format,
+		Parity:      *parity,
+		Threshold:   *threshold,
+		Compression: compression.Compression,
+		Jobs:        *jobs,
+		MaxPixels:   *maxPixels,
+	}
+	if *shares != 0 && *shares != len(carriers) {
+		fmt.Fprintln(os.Stderr, "Shares count must be equal to carriers count.")
+		os.Exit(1)
+	}
+	bar := newProgressBar(os.Stderr)
+	if operation != capacity && isTerminal(os.Stderr) {
+		opts.Progress = bar.update
+	}
 
 	switch operation {
 	case encode:
@@ -61,39 +123,67 @@ func main() {
 			fmt.Fprintln(os.Stderr, "Carrier and result files count must be equal when encoding.")
 			os.Exit(1)
 		}
-		if dataFile == nil || *dataFile == "" {
+		if len(dataFiles) == 0 {
 			fmt.Fprintln(os.Stderr, "Data file must be specified. Use stegify --help for more information.")
 			os.Exit(1)
 		}
+		if (*shares == 0) != (*threshold == 0) { // otherwise the data would be split in chunks, each revealing a part of it
+			fmt.Fprintln(os.Stderr, "Shares and threshold must be specified together when encoding.")
+			os.Exit(1)
+		}
 
-		err := steg.MultiCarrierEncodeByFileNames(carriers, *dataFile, results)
+		err := steg.MultiCarrierEncodeFilesByFileNamesWithOptions(carriers, dataFiles, results, opts)
+		bar.finish()
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
 			os.Exit(1)
 		}
 	case decode:
-		if len(results) == 0 { // if no result provided use default
-			results = append(results, "result")
-		}
-		if len(results) != 1 {
+		if len(results) > 1 {
 			fmt.Fprintln(os.Stderr, "Only one result file expected.")
 			os.Exit(1)
 		}
-		err := steg.MultiCarrierDecodeByFileNames(carriers, results[0])
+		var err error
+		if len(results) == 0 { // if no result provided use the original name of the data file
+			_, err = steg.MultiCarrierDecodeToDir(carriers, *outputDir, opts)
+		} else {
+			err = steg.MultiCarrierDecodeByFileNamesWithOptions(carriers, results[0], opts)
+		}
+		bar.finish()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	case capacity:
+		capacities, err := steg.MultiCarrierCapacityByFileNames(carriers, opts)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
 			os.Exit(1)
 		}
+		total := 0
+		for i, c := range capacities {
+			fmt.Fprintf(os.Stdout, "%s: %d bytes\n", carriers[i], c)
+			total += c
+		}
+		fmt.Fprintf(os.Stdout, "total: %d bytes\n", total)
+		if len(dataFiles) != 0 {
+			size, err := steg.PayloadSizeByFileNames(dataFiles, opts)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			fmt.Fprintf(os.Stdout, "data: %d bytes\n", size)
+		}
 	}
 }
 
 func parseOperation() string {
 	if len(os.Args) < 2 {
-		fmt.Fprintln(os.Stderr, "Operation must be specified [encode/decode]. Use stegify --help for more information.")
+		fmt.Fprintln(os.Stderr, "Operation must be specified [encode/decode/capacity]. Use stegify --help for more information.")
 		os.Exit(1)
 	}
 	operation := os.Args[1]
-	if operation != encode && operation != decode {
+	if operation != encode && operation != decode && operation != capacity {
 		helpFlags := map[string]bool{
 			"--help": true,
 			"-help":  true,
@@ -104,7 +194,7 @@ func parseOperation() string {
 			flag.Parse()
 			os.Exit(0)
 		}
-		fmt.Fprintf(os.Stderr, "Unsupported operation: %s. Only [encode/decode] operations are supported.\n Use stegify --help for more information.", operation)
+		fmt.Fprintf(os.Stderr, "Unsupported operation: %s. Only [encode/decode/capacity] operations are supported.\n Use stegify --help for more information.", operation)
 		os.Exit(1)
 	}
 
@@ -142,3 +232,21 @@ func parseResults() []string {
 
 	return results
 }
+
+func parsePassword() []byte {
+	if *password != "" && *passwordFile != "" {
+		fmt.Fprintln(os.Stderr, "Only one of password and password-file flags could be specified.")
+		os.Exit(1)
+	}
+
+	if *passwordFile != "" {
+		content, err := ioutil.ReadFile(*passwordFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading password file: %v\n", err)
+			os.Exit(1)
+		}
+		return []byte(strings.TrimRight(string(content), "\r\n"))
+	}
+
+	return []byte(*password)
+}
@@ -7,8 +7,10 @@ import (
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestMain(m *testing.M) {
@@ -84,6 +86,79 @@ func TestEncode(t *testing.T) {
 			data:    "examples/video.mp4",
 			results: []string{"result0", "result1"},
 		},
+		{
+			name:    "Encode with --depth flag",
+			args:    []string{"encode", "--carrier", "examples/street.jpeg", "--data", "examples/lake.jpeg", "--result", "result.png", "--depth", "4"},
+			data:    "examples/lake.jpeg",
+			results: []string{"result.png"},
+		},
+		{
+			name:    "Encode with --parity flag",
+			args:    []string{"encode", "--carriers", "examples/street.jpeg examples/lake.jpeg examples/street.jpeg", "--data", "examples/lake.jpeg", "--results", "result1.png result2.png result3.png", "--parity", "1"},
+			data:    "examples/lake.jpeg",
+			results: []string{"result1.png", "result2.png", "result3.png"},
+		},
+		{
+			name:    "Encode with --shares and --threshold flags",
+			args:    []string{"encode", "--carriers", "examples/street.jpeg examples/lake.jpeg examples/street.jpeg", "--data", "examples/lake.jpeg", "--results", "result1.png result2.png result3.png", "--shares", "3", "--threshold", "2"},
+			data:    "examples/lake.jpeg",
+			results: []string{"result1.png", "result2.png", "result3.png"},
+		},
+		{
+			name:       "Encode with --shares not matching carriers count should fail",
+			args:       []string{"encode", "--carriers", "examples/street.jpeg examples/lake.jpeg", "--data", "examples/lake.jpeg", "--results", "result1.png result2.png", "--shares", "3", "--threshold", "2"},
+			shouldFail: true,
+		},
+		{
+			name:       "Encode with --shares flag without --threshold flag should fail",
+			args:       []string{"encode", "--carriers", "examples/street.jpeg examples/lake.jpeg examples/street.jpeg", "--data", "examples/lake.jpeg", "--results", "result1.png result2.png result3.png", "--shares", "3"},
+			shouldFail: true,
+		},
+		{
+			name:       "Encode with --threshold flag without --shares flag should fail",
+			args:       []string{"encode", "--carriers", "examples/street.jpeg examples/lake.jpeg examples/street.jpeg", "--data", "examples/lake.jpeg", "--results", "result1.png result2.png result3.png", "--threshold", "2"},
+			shouldFail: true,
+		},
+		{
+			name:    "Encode with --jobs flag",
+			args:    []string{"encode", "--carriers", "examples/street.jpeg examples/lake.jpeg examples/street.jpeg", "--data", "examples/lake.jpeg", "--results", "result1.png result2.png result3.png", "--jobs", "2"},
+			data:    "examples/lake.jpeg",
+			results: []string{"result1.png", "result2.png", "result3.png"},
+		},
+		{
+			name:    "Encode with --compress flag",
+			args:    []string{"encode", "--carrier", "examples/street.jpeg", "--data", "examples/lake.jpeg", "--result", "result.png", "--compress"},
+			data:    "examples/lake.jpeg",
+			results: []string{"result.png"},
+		},
+		{
+			name:    "Encode with --compress flag with algorithm",
+			args:    []string{"encode", "--carrier", "examples/street.jpeg", "--data", "examples/lake.jpeg", "--result", "result.png", "--compress=deflate"},
+			data:    "examples/lake.jpeg",
+			results: []string{"result.png"},
+		},
+		{
+			name:    "Encode with animated GIF carrier",
+			args:    []string{"encode", "--carrier", "examples/video.gif", "--data", "examples/lake.jpeg", "--result", "result.gif", "--depth", "1"},
+			data:    "examples/lake.jpeg",
+			results: []string{"result.gif"},
+		},
+		{
+			name:    "Encode with --format jpeg flag",
+			args:    []string{"encode", "--carrier", "examples/street.jpeg", "--data", "README.md", "--result", "result.jpeg", "--format", "jpeg"},
+			data:    "README.md",
+			results: []string{"result.jpeg"},
+		},
+		{
+			name:       "Encode with unsupported --compress algorithm should fail",
+			args:       []string{"encode", "--carrier", "examples/street.jpeg", "--data", "examples/lake.jpeg", "--result", "result.png", "--compress=zip"},
+			shouldFail: true,
+		},
+		{
+			name:       "Encode with unsupported --depth flag should fail",
+			args:       []string{"encode", "--carrier", "examples/street.jpeg", "--data", "examples/lake.jpeg", "--result", "result.png", "--depth", "5"},
+			shouldFail: true,
+		},
 		{
 			name:       "Encode carriers count does not match results count should return an error",
 			args:       []string{"encode", "--carriers", "examples/street.jpeg examples/lake.jpeg", "--data", "examples/video.mp4", "--results", "result1.jpeg"},
@@ -142,25 +217,25 @@ func TestDecode(t *testing.T) {
 	}{
 		{
 			name:     "Basic decode",
-			args:     []string{"decode", "--carrier", "examples/test_decode.jpeg", "--result", "result.jpeg"},
+			args:     []string{"decode", "--legacy", "--carrier", "examples/test_decode.jpeg", "--result", "result.jpeg"},
 			expected: "examples/lake.jpeg",
 			result:   "result.jpeg",
 		},
 		{
 			name:     "Decode from multiple carriers using --carier flag",
-			args:     []string{"decode", "--carrier", "examples/test_multi_carrier_decode1.jpeg", "--carrier", "examples/test_multi_carrier_decode2.jpeg", "--result", "result1.mp4"},
+			args:     []string{"decode", "--legacy", "--carrier", "examples/test_multi_carrier_decode1.jpeg", "--carrier", "examples/test_multi_carrier_decode2.jpeg", "--result", "result1.mp4"},
 			expected: "examples/video.mp4",
 			result:   "result1.mp4",
 		},
 		{
 			name:     "Decode from multiple carriers using --cariers flag",
-			args:     []string{"decode", "--carriers", "examples/test_multi_carrier_decode1.jpeg examples/test_multi_carrier_decode2.jpeg", "--result", "result2.mp4"},
+			args:     []string{"decode", "--legacy", "--carriers", "examples/test_multi_carrier_decode1.jpeg examples/test_multi_carrier_decode2.jpeg", "--result", "result2.mp4"},
 			expected: "examples/video.mp4",
 			result:   "result2.mp4",
 		},
 		{
 			name:     "Decode without result flag should add default",
-			args:     []string{"decode", "--carrier", "examples/test_decode.jpeg"},
+			args:     []string{"decode", "--legacy", "--carrier", "examples/test_decode.jpeg"},
 			expected: "examples/lake.jpeg",
 			result:   "result",
 		},
@@ -169,6 +244,11 @@ func TestDecode(t *testing.T) {
 			args:       []string{"decode", "--carriers", "examples/test_multi_carrier_decode1.jpeg examples/test_multi_carrier_decode2.jpeg", "--result", "result1.mp4", "--result", "result2.mp4"},
 			shouldFail: true,
 		},
+		{
+			name:       "Decode carrier without encoded data should fail",
+			args:       []string{"decode", "--carrier", "examples/street.jpeg", "--result", "result"},
+			shouldFail: true,
+		},
 		{
 			name:       "Decode without carrier file should fail",
 			args:       []string{"decode", "--result", "result"},
@@ -199,6 +279,241 @@ func TestDecode(t *testing.T) {
 	}
 }
 
+func TestEncodeDecodeWithPassword(t *testing.T) {
+	err := ioutil.WriteFile("password.txt", []byte("secret\n"), 0600)
+	if err != nil {
+		t.Fatalf("Error writing password file: %v", err)
+	}
+	defer os.Remove("password.txt")
+
+	tests := []struct {
+		name       string
+		encodeArgs []string
+		decodeArgs []string
+		shouldFail bool
+	}{
+		{
+			name:       "Encode and decode with --password flag",
+			encodeArgs: []string{"--password", "secret"},
+			decodeArgs: []string{"--password", "secret"},
+		},
+		{
+			name:       "Encode with --password and decode with --password-file flag",
+			encodeArgs: []string{"--password", "secret"},
+			decodeArgs: []string{"--password-file", "password.txt"},
+		},
+		{
+			name:       "Decode with wrong password should fail",
+			encodeArgs: []string{"--password", "secret"},
+			decodeArgs: []string{"--password", "wrong"},
+			shouldFail: true,
+		},
+		{
+			name:       "Decode without password should fail",
+			encodeArgs: []string{"--password-file", "password.txt"},
+			shouldFail: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			args := append([]string{"encode", "--carrier", "examples/street.jpeg", "--data", "examples/lake.jpeg", "--result", "result.png"}, test.encodeArgs...)
+			t.Logf("Executing: stegify %s", strings.Join(args, " "))
+			cmd := exec.Command("./stegify", args...)
+			cmd.Stdout = os.Stdout
+			cmd.Stderr = os.Stderr
+			if err := cmd.Run(); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			defer os.Remove("result.png")
+
+			args = append([]string{"decode", "--carrier", "result.png", "--result", "decode_result"}, test.decodeArgs...)
+			t.Logf("Executing: stegify %s", strings.Join(args, " "))
+			cmd = exec.Command("./stegify", args...)
+			cmd.Stdout = os.Stdout
+			cmd.Stderr = os.Stderr
+			err := cmd.Run()
+			if err != nil {
+				if test.shouldFail {
+					return
+				}
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if test.shouldFail {
+				t.Fatal("Expected decoding to fail")
+			}
+			defer os.Remove("decode_result")
+
+			assertEqualFiles(t, "examples/lake.jpeg", "decode_result")
+		})
+	}
+}
+
+func TestEncodeDecodeShouldRestoreFileInfo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stegify")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	data, err := ioutil.ReadFile("examples/lake.jpeg")
+	if err != nil {
+		t.Fatalf("Error reading data file: %v", err)
+	}
+	dataName := filepath.Join(dir, "lake.jpeg")
+	if err := ioutil.WriteFile(dataName, data, 0640); err != nil {
+		t.Fatalf("Error writing data file: %v", err)
+	}
+	if err := os.Chmod(dataName, 0640); err != nil { // not affected by umask
+		t.Fatalf("Error changing data file mode: %v", err)
+	}
+	modTime := time.Date(2019, time.November, 7, 12, 30, 0, 0, time.UTC)
+	if err := os.Chtimes(dataName, modTime, modTime); err != nil {
+		t.Fatalf("Error changing data file time: %v", err)
+	}
+
+	args := []string{"encode", "--carrier", "examples/street.jpeg", "--data", dataName, "--result", "result.png"}
+	t.Logf("Executing: stegify %s", strings.Join(args, " "))
+	cmd := exec.Command("./stegify", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.Remove("result.png")
+
+	outputDir := filepath.Join(dir, "output")
+	if err := os.Mkdir(outputDir, 0755); err != nil {
+		t.Fatalf("Error creating output dir: %v", err)
+	}
+	args = []string{"decode", "--carrier", "result.png", "--output-dir", outputDir}
+	t.Logf("Executing: stegify %s", strings.Join(args, " "))
+	cmd = exec.Command("./stegify", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	resultName := filepath.Join(outputDir, "lake.jpeg")
+	assertEqualFiles(t, "examples/lake.jpeg", resultName)
+	stat, err := os.Stat(resultName)
+	if err != nil {
+		t.Fatalf("Error reading decode result file: %v", err)
+	}
+	if stat.Mode().Perm() != 0640 {
+		t.Errorf("Expected mode %v but got %v", os.FileMode(0640), stat.Mode().Perm())
+	}
+	if !stat.ModTime().Equal(modTime) {
+		t.Errorf("Expected modification time %v but got %v", modTime, stat.ModTime())
+	}
+}
+
+func TestEncodeDecodeDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stegify")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"configs/app.yml":          "name: stegify\n",
+		"configs/nested/db.yml":    "host: localhost\n",
+		"configs/nested/empty.txt": "",
+		"notes.txt":                "remember the milk\n",
+	}
+	for name, content := range files {
+		name = filepath.Join(dir, "data", filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatalf("Error creating data dir: %v", err)
+		}
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatalf("Error writing data file: %v", err)
+		}
+	}
+
+	args := []string{"encode", "--carrier", "examples/street.jpeg", "--data", filepath.Join(dir, "data", "configs"), "--data", filepath.Join(dir, "data", "notes.txt"), "--result", "result.png"}
+	t.Logf("Executing: stegify %s", strings.Join(args, " "))
+	cmd := exec.Command("./stegify", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.Remove("result.png")
+
+	outputDir := filepath.Join(dir, "output")
+	args = []string{"decode", "--carrier", "result.png", "--output-dir", outputDir}
+	t.Logf("Executing: stegify %s", strings.Join(args, " "))
+	cmd = exec.Command("./stegify", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for name := range files {
+		assertEqualFiles(t, filepath.Join(dir, "data", filepath.FromSlash(name)), filepath.Join(outputDir, filepath.FromSlash(name)))
+	}
+}
+
+func TestEncodeDecodeCurrentDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stegify")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"app.yml":       "name: stegify\n",
+		"nested/db.yml": "host: localhost\n",
+	}
+	dataDir := filepath.Join(dir, "data")
+	for name, content := range files {
+		name = filepath.Join(dataDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatalf("Error creating data dir: %v", err)
+		}
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatalf("Error writing data file: %v", err)
+		}
+	}
+
+	binary, err := filepath.Abs("stegify")
+	if err != nil {
+		t.Fatalf("Error resolving stegify binary: %v", err)
+	}
+	carrier, err := filepath.Abs("examples/street.jpeg")
+	if err != nil {
+		t.Fatalf("Error resolving carrier file: %v", err)
+	}
+	resultName := filepath.Join(dir, "result.png")
+
+	args := []string{"encode", "--carrier", carrier, "--data", ".", "--result", resultName}
+	t.Logf("Executing: stegify %s", strings.Join(args, " "))
+	cmd := exec.Command(binary, args...)
+	cmd.Dir = dataDir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	outputDir := filepath.Join(dir, "output")
+	args = []string{"decode", "--carrier", resultName, "--output-dir", outputDir}
+	t.Logf("Executing: stegify %s", strings.Join(args, " "))
+	cmd = exec.Command(binary, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for name := range files {
+		assertEqualFiles(t, filepath.Join(dataDir, filepath.FromSlash(name)), filepath.Join(outputDir, "data", filepath.FromSlash(name)))
+	}
+}
+
 func assertEqualFiles(t *testing.T, expected string, given string) {
 	expectedReader, err := os.Open(expected)
 	if err != nil {
@@ -226,3 +541,81 @@ func assertEqualFiles(t *testing.T, expected string, given string) {
 		t.Error("Assertion failed!")
 	}
 }
+
+func TestCapacity(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		expected   string
+		shouldFail bool
+	}{
+		{
+			name:     "Capacity of single carrier",
+			args:     []string{"capacity", "--carrier", "examples/street.jpeg"},
+			expected: "examples/street.jpeg: 1843182 bytes\ntotal: 1843182 bytes\n",
+		},
+		{
+			name:     "Capacity of multiple carriers",
+			args:     []string{"capacity", "--carriers", "examples/street.jpeg examples/lake.jpeg"},
+			expected: "examples/street.jpeg: 1843170 bytes\nexamples/lake.jpeg: 2359266 bytes\ntotal: 4202436 bytes\n",
+		},
+		{
+			name:     "Capacity with --depth flag",
+			args:     []string{"capacity", "--carrier", "examples/street.jpeg", "--depth", "1"},
+			expected: "examples/street.jpeg: 921590 bytes\ntotal: 921590 bytes\n",
+		},
+		{
+			name:     "Capacity with --format jpeg flag",
+			args:     []string{"capacity", "--carrier", "examples/street.jpeg", "--format", "jpeg"},
+			expected: "examples/street.jpeg: 95431 bytes\ntotal: 95431 bytes\n",
+		},
+		{
+			name:     "Capacity with --parity flag",
+			args:     []string{"capacity", "--carriers", "examples/street.jpeg examples/lake.jpeg", "--parity", "1"},
+			expected: "examples/street.jpeg: 1843159 bytes\nexamples/lake.jpeg: 0 bytes\ntotal: 1843159 bytes\n",
+		},
+		{
+			name:     "Capacity with --threshold flag",
+			args:     []string{"capacity", "--carriers", "examples/street.jpeg examples/lake.jpeg", "--threshold", "2"},
+			expected: "examples/street.jpeg: 1843167 bytes\nexamples/lake.jpeg: 0 bytes\ntotal: 1843167 bytes\n",
+		},
+		{
+			name:     "Capacity with --data flag",
+			args:     []string{"capacity", "--carrier", "examples/street.jpeg", "--data", "examples/lake.jpeg"},
+			expected: "examples/street.jpeg: 1843182 bytes\ntotal: 1843182 bytes\ndata: 527297 bytes\n", // with the file info record
+		},
+		{
+			name:     "Capacity with --compress flag",
+			args:     []string{"capacity", "--carrier", "examples/street.jpeg", "--compress"},
+			expected: "examples/street.jpeg: 1843180 bytes\ntotal: 1843180 bytes\n",
+		},
+		{
+			name:       "Capacity of missing carrier should fail",
+			args:       []string{"capacity", "--carrier", "not_existing_file"},
+			shouldFail: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Logf("Executing: stegify %s", strings.Join(test.args, " "))
+			cmd := exec.Command("./stegify", test.args...)
+			cmd.Stderr = os.Stderr
+
+			output, err := cmd.Output()
+			if err != nil {
+				if test.shouldFail {
+					return
+				}
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if test.shouldFail {
+				t.Fatal("Expected capacity command to fail")
+			}
+
+			if string(output) != test.expected {
+				t.Errorf("Expected output %q but got %q", test.expected, output)
+			}
+		})
+	}
+}